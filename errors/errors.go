@@ -0,0 +1,194 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Error 业务错误，通过 errdetails.ErrorInfo 传递 reason, metadata，errdetails.RetryInfo 传递是否可重试
+type Error struct {
+	Code       codes.Code        // grpc 错误码
+	Reason     string            // 业务错误码，如 USER_NOT_FOUND
+	Message    string            // 错误信息
+	Metadata   map[string]string // 附加信息
+	Retryable  bool              // 是否可重试
+	RetryDelay time.Duration     // 建议的重试间隔
+	Details    []proto.Message   // 其他 errdetails
+
+	cause error
+}
+
+// New 创建业务错误，一般定义为包级变量，通过 errors.Is 判断
+func New(code codes.Code, reason, message string) *Error {
+	return &Error{Code: code, Reason: reason, Message: message}
+}
+
+// Newf 创建业务错误
+func Newf(code codes.Code, reason, format string, args ...interface{}) *Error {
+	return New(code, reason, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Reason) > 0 {
+		msg = e.Reason + ": " + msg
+	}
+	if e.cause != nil {
+		msg = msg + ": " + e.cause.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is code 和 reason 相同时认为是同一个错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code && e.Reason == t.Reason
+}
+
+func (e *Error) clone() *Error {
+	c := *e
+	if e.Metadata != nil {
+		c.Metadata = make(map[string]string, len(e.Metadata))
+		for k, v := range e.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	c.Details = append([]proto.Message(nil), e.Details...)
+	return &c
+}
+
+// WithCause 返回附带原始错误的副本，原始错误不会传递给调用方
+func (e *Error) WithCause(cause error) *Error {
+	c := e.clone()
+	c.cause = cause
+	return c
+}
+
+// WithMessage 返回替换错误信息的副本
+func (e *Error) WithMessage(format string, args ...interface{}) *Error {
+	c := e.clone()
+	c.Message = fmt.Sprintf(format, args...)
+	return c
+}
+
+// WithMetadata 返回附带 metadata 的副本
+func (e *Error) WithMetadata(metadata map[string]string) *Error {
+	c := e.clone()
+	if c.Metadata == nil {
+		c.Metadata = make(map[string]string, len(metadata))
+	}
+	for k, v := range metadata {
+		c.Metadata[k] = v
+	}
+	return c
+}
+
+// WithRetry 返回可重试的副本，delay 为建议的重试间隔，0 表示不指定
+func (e *Error) WithRetry(delay time.Duration) *Error {
+	c := e.clone()
+	c.Retryable = true
+	c.RetryDelay = delay
+	return c
+}
+
+// WithDetails 返回附带 errdetails 的副本，如 errdetails.BadRequest
+func (e *Error) WithDetails(details ...proto.Message) *Error {
+	c := e.clone()
+	c.Details = append(c.Details, details...)
+	return c
+}
+
+// GRPCStatus 实现 status.FromError 的接口
+func (e *Error) GRPCStatus() *status.Status {
+	s := status.New(e.Code, e.Message)
+
+	details := make([]proto.Message, 0, len(e.Details)+2)
+	if len(e.Reason) > 0 || len(e.Metadata) > 0 {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.Reason, Metadata: e.Metadata})
+	}
+	if e.Retryable {
+		info := &errdetails.RetryInfo{}
+		if e.RetryDelay > 0 {
+			info.RetryDelay = durationpb.New(e.RetryDelay)
+		}
+		details = append(details, info)
+	}
+	details = append(details, e.Details...)
+	if len(details) < 1 {
+		return s
+	}
+
+	if ds, err := s.WithDetails(details...); err == nil {
+		return ds
+	}
+	return s
+}
+
+// FromError 将 error 转换为 *Error，用于解析下游返回的错误，err 为 nil 时返回 nil
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return &Error{Code: codes.Unknown, Message: err.Error()}
+	}
+
+	e = &Error{Code: s.Code(), Message: s.Message()}
+	for _, detail := range s.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason = d.GetReason()
+			e.Metadata = d.GetMetadata()
+		case *errdetails.RetryInfo:
+			e.Retryable = true
+			e.RetryDelay = d.GetRetryDelay().AsDuration()
+		case proto.Message:
+			e.Details = append(e.Details, d)
+		}
+	}
+	return e
+}
+
+// Code 获取错误码，err 为 nil 时返回 OK
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	return FromError(err).Code
+}
+
+// Reason 获取业务错误码
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	return FromError(err).Reason
+}
+
+// IsRetryable 是否可重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return FromError(err).Retryable
+}
@@ -0,0 +1,46 @@
+package errors_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	apperrors "github.com/limingyao/excellent-go/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUserNotFound = apperrors.New(codes.NotFound, "USER_NOT_FOUND", "user not found")
+
+func TestError(t *testing.T) {
+	err := errUserNotFound.
+		WithMessage("user %d not found", 1).
+		WithMetadata(map[string]string{"user_id": "1"}).
+		WithRetry(time.Second).
+		WithDetails(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "id"}}}).
+		WithCause(errors.New("sql: no rows in result set"))
+
+	if !errors.Is(fmt.Errorf("wrap: %w", err), errUserNotFound) {
+		t.Error("expect errors.Is USER_NOT_FOUND")
+	}
+	if errUserNotFound.Message != "user not found" || errUserNotFound.Metadata != nil {
+		t.Error("With* should not modify the original error")
+	}
+
+	// 经过 status 传递后还原
+	s, _ := status.FromError(err)
+	e := apperrors.FromError(s.Err())
+	if e.Code != codes.NotFound || e.Reason != "USER_NOT_FOUND" || e.Message != "user 1 not found" ||
+		e.Metadata["user_id"] != "1" || !e.Retryable || e.RetryDelay != time.Second || len(e.Details) != 1 {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if !errors.Is(e, errUserNotFound) || !apperrors.IsRetryable(s.Err()) {
+		t.Error("expect retryable USER_NOT_FOUND")
+	}
+
+	if apperrors.Code(nil) != codes.OK || apperrors.Code(errors.New("unknown")) != codes.Unknown {
+		t.Error("unexpected code")
+	}
+}
@@ -2,6 +2,7 @@ package logrus
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -19,11 +20,15 @@ const defaultTimestampFormat = "2006-01-02 15:04:05.000"
 
 type CallerPrettyfier func(*runtime.Frame) (function string, file string)
 
+// ContextValuer 读取 context 中的字段，用于非 string 类型的 context key，返回 nil 时不打印
+type ContextValuer func(ctx context.Context) interface{}
+
 type ReadableFormatter struct {
 	TimestampFormat  string
 	DisableSorting   bool
 	CallerPrettyfier CallerPrettyfier
 	CtxFields        []string
+	CtxValuers       map[string]ContextValuer
 }
 
 func simplifyFilePath(s string) string {
@@ -118,7 +123,13 @@ func (f *ReadableFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	// fields
 	if entry.Context != nil && len(f.CtxFields) > 0 {
 		for _, key := range f.CtxFields {
-			if val := entry.Context.Value(key); val != nil {
+			var val interface{}
+			if valuer, ok := f.CtxValuers[key]; ok {
+				val = valuer(entry.Context)
+			} else {
+				val = entry.Context.Value(key)
+			}
+			if val != nil {
 				f.appendKeyValue(b, key, val)
 			}
 		}
@@ -163,6 +174,15 @@ func (f *ReadableFormatter) appendValue(b *bytes.Buffer, value interface{}) {
 	b.WriteString(fmt.Sprintf("%s", stringVal))
 }
 
+func contains(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	logrus.SetLevel(logrus.TraceLevel)
 	logrus.SetReportCaller(true)
@@ -180,9 +200,17 @@ func setLogger(logger *logrus.Logger, opts ...Option) {
 	}
 
 	// formatter
+	ctxFields := append([]string(nil), defaultOpts.ctxFields...)
+	for field := range defaultOpts.ctxValuers {
+		if !contains(ctxFields, field) {
+			ctxFields = append(ctxFields, field)
+		}
+	}
+	sort.Strings(ctxFields)
 	logger.SetFormatter(&ReadableFormatter{
 		CallerPrettyfier: defaultCallerPrettyfier,
-		CtxFields:        defaultOpts.ctxFields,
+		CtxFields:        ctxFields,
+		CtxValuers:       defaultOpts.ctxValuers,
 	})
 
 	// level
@@ -2,6 +2,7 @@ package logrus_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/limingyao/excellent-go/log/logrus"
@@ -18,6 +19,29 @@ func TestReadableFormatter(t *testing.T) {
 	log.WithContext(ctx).Debugf("testing log")
 }
 
+type typedKey struct{}
+
+func TestReadableFormatterContextValuers(t *testing.T) {
+	f := &logrus.ReadableFormatter{
+		CtxFields: []string{"key1", "typed"},
+		CtxValuers: map[string]logrus.ContextValuer{
+			"typed": func(ctx context.Context) interface{} {
+				return ctx.Value(typedKey{})
+			},
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "key1", "value1")
+	ctx = context.WithValue(ctx, typedKey{}, "value2")
+	b, err := f.Format(&log.Entry{Context: ctx, Message: "testing log", Level: log.InfoLevel, Data: log.Fields{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "key1=value1 typed=value2 testing log") {
+		t.Errorf("unexpected log %s", b)
+	}
+}
+
 func BenchmarkReadableFormatter(b *testing.B) {
 	logrus.Init(
 		logrus.WithContextFields("key1", "key2"),
@@ -1,18 +1,20 @@
 package logrus
 
 import (
+	"context"
 	"sort"
 	"time"
 )
 
 type options struct {
-	level         string        // 日志级别
-	ctxFields     []string      // 打印 context 中的字段
-	disableCaller bool          // 关闭打印行号
-	disableStdout bool          // 关闭终端打印
-	logDir        string        // 日志目录
-	fileName      string        // 日志名
-	maxAge        time.Duration // 日志保留时长
+	level         string                   // 日志级别
+	ctxFields     []string                 // 打印 context 中的字段
+	ctxValuers    map[string]ContextValuer // 字段对应的读取函数
+	disableCaller bool                     // 关闭打印行号
+	disableStdout bool                     // 关闭终端打印
+	logDir        string                   // 日志目录
+	fileName      string                   // 日志名
+	maxAge        time.Duration            // 日志保留时长
 }
 
 var (
@@ -55,6 +57,18 @@ func WithContextFields(fields ...string) Option {
 	})
 }
 
+// WithContextValuers 打印 ctx 中非 string 类型 key 的字段，如 interceptors.ContextValuers()
+func WithContextValuers(valuers map[string]func(ctx context.Context) interface{}) Option {
+	return newFuncOption(func(o *options) {
+		if o.ctxValuers == nil {
+			o.ctxValuers = make(map[string]ContextValuer, len(valuers))
+		}
+		for field, valuer := range valuers {
+			o.ctxValuers[field] = valuer
+		}
+	})
+}
+
 // WithDisableCaller 关闭日志打印调用行号
 func WithDisableCaller() Option {
 	return newFuncOption(func(o *options) {
@@ -17,6 +17,20 @@ func MustRegister(cs ...prometheus.Collector) {
 	defaultRegister.MustRegister(cs...)
 }
 
+// Register 注册 collector，已注册时返回 prometheus.AlreadyRegisteredError
+func Register(c prometheus.Collector) error {
+	return defaultRegister.Register(c)
+}
+
+// mustRegisterOnce 忽略已注册的 collector，多次调用 Handler 时不会 panic
+func mustRegisterOnce(c prometheus.Collector) {
+	if err := defaultRegister.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+}
+
 func HandleDefault(httpMux *http.ServeMux, opts ...Option) {
 	httpMux.Handle("/metrics", Handler(opts...))
 }
@@ -28,19 +42,19 @@ func Handler(opts ...Option) http.Handler {
 	}
 
 	if !defaultOpts.disableProcessCollector {
-		MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		mustRegisterOnce(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	}
 	if !defaultOpts.disableProcessExtCollector {
-		MustRegister(collector.NewProcessExtCollector(collector.ProcessExtCollectorOpts{}))
+		mustRegisterOnce(collector.NewProcessExtCollector(collector.ProcessExtCollectorOpts{}))
 	}
 	if defaultOpts.enableDiskUsageCollector {
-		MustRegister(collector.NewDiskUsageCollector(collector.DiskUsageCollectorOpts{}))
+		mustRegisterOnce(collector.NewDiskUsageCollector(collector.DiskUsageCollectorOpts{}))
 	}
 	if defaultOpts.enableGoCollector {
-		MustRegister(collectors.NewGoCollector())
+		mustRegisterOnce(collectors.NewGoCollector())
 	}
 	if !defaultOpts.disableGoSimpleCollector {
-		MustRegister(collector.NewGoSimpleCollector(collector.GoSimpleCollectorOpts{}))
+		mustRegisterOnce(collector.NewGoSimpleCollector(collector.GoSimpleCollectorOpts{}))
 	}
 	if defaultOpts.disableInstrumentMetricHandler {
 		return promhttp.HandlerFor(defaultRegister, promhttp.HandlerOpts{})
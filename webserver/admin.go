@@ -0,0 +1,202 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// admin 内部端口，提供 pprof, metrics, 健康检查和 reflection
+type admin struct {
+	ip      string
+	port    int
+	lis     net.Listener
+	httpMux *http.ServeMux
+	grpcSrv *grpc.Server
+	httpSrv *http.Server
+}
+
+// unixSocket 额外监听的 unix socket，与公开端口提供相同的服务
+type unixSocket struct {
+	path    string
+	lis     net.Listener
+	httpSrv *http.Server
+}
+
+// localHealthClient 进程内调用健康检查，admin 端口的 /healthz 不需要连接自身
+type localHealthClient struct {
+	server healthpb.HealthServer
+}
+
+func (c localHealthClient) Check(
+	ctx context.Context, in *healthpb.HealthCheckRequest, _ ...grpc.CallOption,
+) (*healthpb.HealthCheckResponse, error) {
+	return c.server.Check(ctx, in)
+}
+
+func (c localHealthClient) Watch(
+	context.Context, *healthpb.HealthCheckRequest, ...grpc.CallOption,
+) (healthpb.Health_WatchClient, error) {
+	return nil, status.Error(codes.Unimplemented, "watch is not supported")
+}
+
+// listenExtra 监听 admin 端口和 unix socket，调用方持有 s.mu
+func (s *Webserver) listenExtra() error {
+	if s.admin != nil && s.admin.lis == nil {
+		addr := net.JoinHostPort(s.admin.ip, strconv.Itoa(s.admin.port))
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return &ListenError{Network: "tcp", Addr: addr, Err: err}
+		}
+		s.admin.lis = lis
+	}
+	if s.unix != nil && s.unix.lis == nil {
+		// 删除上次退出时残留的 socket 文件
+		if fi, err := os.Stat(s.unix.path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(s.unix.path)
+		}
+		lis, err := net.Listen("unix", s.unix.path)
+		if err != nil {
+			if s.admin != nil && s.admin.lis != nil {
+				_ = s.admin.lis.Close()
+				s.admin.lis = nil
+			}
+			return &ListenError{Network: "unix", Addr: s.unix.path, Err: err}
+		}
+		s.unix.lis = lis
+	}
+	return nil
+}
+
+// AdminAddr 返回 admin 端口的监听地址，未开启 WithAdminAddr 或未监听时返回 nil
+func (s *Webserver) AdminAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.admin == nil || s.admin.lis == nil {
+		return nil
+	}
+	return s.admin.lis.Addr()
+}
+
+// internalMux pprof, metrics, 健康检查注册的 http mux
+func (s *Webserver) internalMux() *http.ServeMux {
+	if s.admin != nil {
+		return s.admin.httpMux
+	}
+	return s.httpMux
+}
+
+// internalGrpcServer 健康检查, reflection 注册的 grpc server
+func (s *Webserver) internalGrpcServer() *grpc.Server {
+	if s.admin != nil {
+		return s.admin.grpcSrv
+	}
+	return s.grpcSrv
+}
+
+// registerAdminReflectionServer admin 端口的 reflection 返回公开端口注册的服务
+func (s *Webserver) registerAdminReflectionServer() {
+	opts := reflection.ServerOptions{Services: s.grpcSrv}
+	reflectionv1alpha.RegisterServerReflectionServer(s.admin.grpcSrv, reflection.NewServer(opts))
+	reflectionv1.RegisterServerReflectionServer(s.admin.grpcSrv, reflection.NewServerV1(opts))
+}
+
+// registerAdminHealthEndpoint admin 端口的 /healthz
+func (s *Webserver) registerAdminHealthEndpoint() {
+	mux := runtime.NewServeMux()
+	runtime.WithHealthEndpointAt(localHealthClient{server: s.healthz.server}, s.healthzPath)(mux)
+	s.admin.httpMux.Handle(s.healthzPath, mux)
+}
+
+func (a *admin) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			a.grpcSrv.ServeHTTP(w, r)
+		} else {
+			a.httpMux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serveExtra 在 admin 端口和 unix socket 上提供服务，handler 为公开端口的 handler，ServeTLS 时同样使用明文 h2c
+func (s *Webserver) serveExtra(handler http.Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.listenExtra(); err != nil {
+		return err
+	}
+	if s.admin != nil {
+		s.admin.httpSrv = &http.Server{Handler: h2c.NewHandler(s.admin.handler(), &http2.Server{})}
+		go serveExtra("admin", s.admin.httpSrv, s.admin.lis)
+	}
+	if s.unix != nil {
+		h2s := &http2.Server{}
+		s.unix.httpSrv = &http.Server{Handler: h2c.NewHandler(handler, h2s)}
+		if err := http2.ConfigureServer(s.unix.httpSrv, h2s); err != nil {
+			return err
+		}
+		go serveExtra("unix socket", s.unix.httpSrv, s.unix.lis)
+	}
+	return nil
+}
+
+func serveExtra(name string, srv *http.Server, lis net.Listener) {
+	log.Infof("webserver %s started on %s", name, lis.Addr().String())
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.WithError(err).Errorf("webserver %s serve fail", name)
+	}
+}
+
+// shutdownUnix 与公开端口一起停止接收新请求
+func (s *Webserver) shutdownUnix(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unix == nil || s.unix.httpSrv == nil {
+		return nil
+	}
+	return s.unix.httpSrv.Shutdown(ctx)
+}
+
+// shutdownAdmin 公开端口退出后再停止，drain 期间健康检查仍然可用
+func (s *Webserver) shutdownAdmin(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.admin == nil || s.admin.httpSrv == nil {
+		return
+	}
+	_ = s.admin.httpSrv.Shutdown(ctx)
+	s.admin.grpcSrv.Stop()
+}
+
+// closeExtra 立即关闭 admin 端口和 unix socket
+func (s *Webserver) closeExtra() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unix != nil && s.unix.httpSrv != nil {
+		_ = s.unix.httpSrv.Close()
+	}
+	if s.admin != nil {
+		if s.admin.httpSrv != nil {
+			_ = s.admin.httpSrv.Close()
+		}
+		s.admin.grpcSrv.Stop()
+	}
+}
@@ -0,0 +1,428 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptorSetExts 目录中加载的文件后缀，protoc --descriptor_set_out 生成的文件
+var descriptorSetExts = []string{".desc", ".protoset"}
+
+// descriptorSet 从 FileDescriptorSet 加载服务，根据 google.api.http 注解动态转码 http 请求，不需要编译 .pb.gw.go，
+// 未匹配的请求交给 gatewayMux 处理
+type descriptorSet struct {
+	paths       []string
+	endpoint    string // 为空时连接本服务
+	dialOptions []grpc.DialOption
+	options     []runtime.ServeMuxOption
+	fallback    http.Handler
+	conn        *grpc.ClientConn
+
+	reloadMu sync.Mutex
+	mu       sync.RWMutex
+	mux      *runtime.ServeMux
+	routes   []Route
+	modTime  time.Time
+}
+
+// files 展开目录，返回所有 descriptor set 文件，目录本身也参与修改时间的比较
+func (d *descriptorSet) files() (files []string, modTime time.Time, err error) {
+	for _, path := range d.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, modTime, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !hasDescriptorSetExt(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, modTime, err
+			}
+			if info.ModTime().After(modTime) {
+				modTime = info.ModTime()
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, modTime, nil
+}
+
+func hasDescriptorSetExt(name string) bool {
+	for _, ext := range descriptorSetExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFiles 合并多个 FileDescriptorSet，同名的 proto 文件只保留第一个，如多个文件都包含的 google/api/annotations.proto
+func loadFiles(files []string) (*descriptorpb.FileDescriptorSet, error) {
+	merged := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := protov2.Unmarshal(b, set); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		for _, fd := range set.GetFile() {
+			if seen[fd.GetName()] {
+				continue
+			}
+			seen[fd.GetName()] = true
+			merged.File = append(merged.File, fd)
+		}
+	}
+	return merged, nil
+}
+
+// reload force 为 false 时只在文件有变更时重新加载，返回是否发生了重新加载，加载失败时继续使用之前的路由
+func (d *descriptorSet) reload(force bool) (bool, error) {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	files, modTime, err := d.files()
+	if err != nil {
+		return false, err
+	}
+	d.mu.RLock()
+	unchanged := d.mux != nil && modTime.Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged && !force {
+		return false, nil
+	}
+
+	set, err := loadFiles(files)
+	if err != nil {
+		return false, err
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return false, err
+	}
+
+	opts := append(append([]runtime.ServeMuxOption{}, d.options...), runtime.WithRoutingErrorHandler(d.routingError))
+	mux := runtime.NewServeMux(opts...)
+	var routes []Route
+	registry.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len() && err == nil; i++ {
+			routes, err = d.handleService(mux, services.Get(i), routes)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	d.mux = mux
+	d.routes = routes
+	d.modTime = modTime
+	d.mu.Unlock()
+
+	return true, nil
+}
+
+// handleService 注册服务中带 google.api.http 注解的方法，不支持客户端流和双向流
+func (d *descriptorSet) handleService(
+	mux *runtime.ServeMux, sd protoreflect.ServiceDescriptor, routes []Route,
+) ([]Route, error) {
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		rules := httpRules(md)
+		if len(rules) < 1 {
+			continue
+		}
+		fullMethod := "/" + string(sd.FullName()) + "/" + string(md.Name())
+		if md.IsStreamingClient() {
+			log.Warnf("skip client streaming method %s", fullMethod)
+			continue
+		}
+		for _, rule := range rules {
+			method, path := httpRulePattern(rule)
+			if len(path) < 1 {
+				continue
+			}
+			if err := mux.HandlePath(method, path, d.handler(mux, md, fullMethod, path, rule)); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", fullMethod, path, err)
+			}
+			routes = append(routes, Route{Method: method, Path: path, GrpcMethod: fullMethod, Body: rule.GetBody()})
+		}
+	}
+	return routes, nil
+}
+
+// routingError 没有匹配的动态路由时交给 gatewayMux，由 gatewayMux 返回路由错误
+func (d *descriptorSet) routingError(
+	_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, _ int,
+) {
+	d.fallback.ServeHTTP(w, r)
+}
+
+func (d *descriptorSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	mux := d.mux
+	d.mu.RUnlock()
+	mux.ServeHTTP(w, r)
+}
+
+func (d *descriptorSet) Routes() []Route {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]Route(nil), d.routes...)
+}
+
+// watch 定时检查 descriptor set 文件，直到 ctx 结束
+func (d *descriptorSet) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := d.reload(false)
+			if err != nil {
+				log.WithError(err).Errorf("reload descriptor set %v fail, keep serving the previous one", d.paths)
+				continue
+			}
+			if reloaded {
+				log.Infof("descriptor set %v reloaded", d.paths)
+			}
+		}
+	}
+}
+
+// handler 与生成的 .pb.gw.go 相同的转码规则：路径参数，body 字段，其余字段从 query 参数读取
+func (d *descriptorSet) handler(
+	mux *runtime.ServeMux, md protoreflect.MethodDescriptor, fullMethod, path string, rule *annotations.HttpRule,
+) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, fullMethod, runtime.WithHTTPPathPattern(path))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		req, err := newRequest(md, rule, inbound, r, pathParams)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		if md.IsStreamingServer() {
+			d.forwardStream(ctx, mux, outbound, w, r, md, fullMethod, req)
+			return
+		}
+
+		var header, trailer metadata.MD
+		resp := dynamicpb.NewMessage(md.Output())
+		err = d.conn.Invoke(ctx, fullMethod, req, resp, grpc.Header(&header), grpc.Trailer(&trailer))
+		ctx = runtime.NewServerMetadataContext(ctx, runtime.ServerMetadata{HeaderMD: header, TrailerMD: trailer})
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, responseBody(resp, rule))
+	}
+}
+
+func (d *descriptorSet) forwardStream(
+	ctx context.Context, mux *runtime.ServeMux, outbound runtime.Marshaler, w http.ResponseWriter, r *http.Request,
+	md protoreflect.MethodDescriptor, fullMethod string, req protov2.Message,
+) {
+	stream, err := d.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+	if err == nil {
+		err = stream.SendMsg(req)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	var header metadata.MD
+	if err == nil {
+		header, err = stream.Header()
+	}
+	if err != nil {
+		runtime.HTTPError(ctx, mux, outbound, w, r, err)
+		return
+	}
+	ctx = runtime.NewServerMetadataContext(ctx, runtime.ServerMetadata{HeaderMD: header})
+	runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (protov2.Message, error) {
+		resp := dynamicpb.NewMessage(md.Output())
+		return resp, stream.RecvMsg(resp)
+	})
+}
+
+// newRequest 按 body, 路径参数, query 参数的顺序填充请求
+func newRequest(
+	md protoreflect.MethodDescriptor, rule *annotations.HttpRule, inbound runtime.Marshaler, r *http.Request,
+	pathParams map[string]string,
+) (*dynamicpb.Message, error) {
+	req := dynamicpb.NewMessage(md.Input())
+	body := rule.GetBody()
+	switch body {
+	case "":
+	case "*":
+		if err := decodeBody(inbound, r.Body, req); err != nil {
+			return nil, err
+		}
+	default:
+		fd := req.Descriptor().Fields().ByName(protoreflect.Name(body))
+		if fd == nil || fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return nil, status.Errorf(codes.Unimplemented, "body field %s must be a message", body)
+		}
+		if err := decodeBody(inbound, r.Body, req.Mutable(fd).Message().Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	filter := make([][]string, 0, len(pathParams)+1)
+	for name, value := range pathParams {
+		if err := runtime.PopulateFieldFromPath(req, name, value); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", name, err)
+		}
+		filter = append(filter, strings.Split(name, "."))
+	}
+	if body == "*" {
+		return req, nil
+	}
+	if len(body) > 0 {
+		filter = append(filter, []string{body})
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := runtime.PopulateQueryParameters(req, r.Form, utilities.NewDoubleArray(filter)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return req, nil
+}
+
+func decodeBody(inbound runtime.Marshaler, body io.Reader, msg protov2.Message) error {
+	if err := inbound.NewDecoder(body).Decode(msg); err != nil && !errors.Is(err, io.EOF) {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return nil
+}
+
+// responseBody 返回 response_body 指定的字段，只支持 message 类型的字段
+func responseBody(resp *dynamicpb.Message, rule *annotations.HttpRule) protov2.Message {
+	name := rule.GetResponseBody()
+	if len(name) < 1 {
+		return resp
+	}
+	fd := resp.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil || fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return resp
+	}
+	return resp.Get(fd).Message().Interface()
+}
+
+// registerDescriptorSet 启动时加载 descriptor set，加载失败时启动失败
+func (s *Webserver) registerDescriptorSet() error {
+	d := s.descriptors
+	endpoint, opts := d.endpoint, d.dialOptions
+	if len(endpoint) < 1 {
+		endpoint, opts = s.endpoint(), s.loopbackDialOptions()
+	}
+	cc, err := grpc.Dial(endpoint, opts...)
+	if err != nil {
+		return &RegisterError{Endpoint: endpoint, Err: err}
+	}
+	go func() {
+		<-s.ctx.Done()
+		_ = cc.Close()
+	}()
+
+	d.conn = cc
+	d.options = s.gatewayOptions
+	d.fallback = s.gatewayMux
+	if _, err := d.reload(true); err != nil {
+		return err
+	}
+	if s.descriptorReloadInterval > 0 {
+		go d.watch(s.ctx, s.descriptorReloadInterval)
+	}
+	return nil
+}
+
+// ReloadDescriptorSet 立即重新加载 WithDescriptorSet 配置的文件，加载失败时继续使用之前的路由
+func (s *Webserver) ReloadDescriptorSet() error {
+	if s.descriptors == nil {
+		return ErrDescriptorSetNotConfigured
+	}
+	s.descriptors.mu.RLock()
+	loaded := s.descriptors.mux != nil
+	s.descriptors.mu.RUnlock()
+	if !loaded {
+		return ErrServerNotStarted
+	}
+	_, err := s.descriptors.reload(true)
+	return err
+}
+
+// sortRoutes 按路径和方法排序并去重
+func sortRoutes(routes []Route) []Route {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		if routes[i].Method != routes[j].Method {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].GrpcMethod < routes[j].GrpcMethod
+	})
+	unique := routes[:0]
+	for i, route := range routes {
+		if i > 0 && route == routes[i-1] {
+			continue
+		}
+		unique = append(unique, route)
+	}
+	return unique
+}
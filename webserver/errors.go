@@ -0,0 +1,44 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrServerListening  = errors.New("webserver already listening")
+	ErrServerStarted    = errors.New("webserver already started")
+	ErrServerNotStarted = errors.New("webserver not started")
+	ErrTLSNotConfigured = errors.New("tls certificate not configured, use WithTLS")
+
+	ErrDescriptorSetNotConfigured = errors.New("descriptor set not configured, use WithDescriptorSet")
+)
+
+// ListenError 监听地址失败，如端口被占用
+type ListenError struct {
+	Network string
+	Addr    string
+	Err     error
+}
+
+func (e *ListenError) Error() string {
+	return fmt.Sprintf("listen %s %s failed: %v", e.Network, e.Addr, e.Err)
+}
+
+func (e *ListenError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterError 注册 gateway handler, healthz 连接 endpoint 失败
+type RegisterError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *RegisterError) Error() string {
+	return fmt.Sprintf("register handler from endpoint %s failed: %v", e.Endpoint, e.Err)
+}
+
+func (e *RegisterError) Unwrap() error {
+	return e.Err
+}
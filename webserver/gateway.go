@@ -0,0 +1,111 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/limingyao/excellent-go/encoding"
+	apperrors "github.com/limingyao/excellent-go/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	sessionIdHeader = "X-Session-Id"
+	requestIdHeader = "X-Request-Id"
+)
+
+// IncomingHeaderMatcher 在 runtime.DefaultHeaderMatcher 的基础上转发 X-Session-Id, X-Request-Id，NewServer 默认使用
+func IncomingHeaderMatcher(key string) (string, bool) {
+	switch key := textproto.CanonicalMIMEHeaderKey(key); key {
+	case sessionIdHeader, requestIdHeader:
+		return key, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// ErrorResponse gateway 统一的错误响应
+type ErrorResponse struct {
+	Code      int32             `json:"code"`                 // grpc 错误码
+	Status    string            `json:"status"`               // grpc 错误码名称，如 NOT_FOUND
+	Reason    string            `json:"reason,omitempty"`     // 业务错误码
+	Message   string            `json:"message"`              // 错误信息
+	Metadata  map[string]string `json:"metadata,omitempty"`   // 附加信息
+	Retryable bool              `json:"retryable"`            // 是否可重试
+	Details   []json.RawMessage `json:"details,omitempty"`    // 其他 errdetails，如 BadRequest
+	SessionId string            `json:"session_id,omitempty"` // 请求的 session id
+}
+
+// sessionIdFromGateway 优先使用请求头，其次使用服务端返回的 header, trailer
+func sessionIdFromGateway(ctx context.Context, r *http.Request) string {
+	if sessionId := r.Header.Get(sessionIdHeader); len(sessionId) > 0 {
+		return sessionId
+	}
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.HeaderMD.Get(sessionIdHeader); len(values) > 0 {
+		return values[0]
+	}
+	if values := md.TrailerMD.Get(sessionIdHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ErrorHandler gateway 错误处理，通过 runtime.WithErrorHandler 设置，错误响应格式为 ErrorResponse
+func ErrorHandler(
+	ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error,
+) {
+	httpStatus := 0
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		httpStatus = customStatus.HTTPStatus
+		err = customStatus.Err
+	}
+
+	e := apperrors.FromError(err)
+	if httpStatus == 0 {
+		httpStatus = runtime.HTTPStatusFromCode(e.Code)
+	}
+
+	resp := ErrorResponse{
+		Code:      int32(e.Code),
+		Status:    code.Code(e.Code).String(),
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Metadata:  e.Metadata,
+		Retryable: e.Retryable,
+		SessionId: sessionIdFromGateway(ctx, r),
+	}
+	for _, detail := range e.Details {
+		a, err := anypb.New(proto.MessageV2(detail))
+		if err != nil {
+			continue
+		}
+		if b, err := protojson.Marshal(a); err == nil {
+			resp.Details = append(resp.Details, b)
+		}
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", encoding.MIMEJSON)
+	if e.RetryDelay > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(e.RetryDelay.Seconds())), 10))
+	}
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.WithError(err).Error("write error response fail")
+	}
+}
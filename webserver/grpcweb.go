@@ -0,0 +1,248 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"golang.org/x/net/http2"
+)
+
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	grpcWebTrailerFlag = 0x80
+)
+
+// grpcWebCORSOptions 浏览器 grpc-web 客户端需要的跨域配置，WithGrpcWeb 的参数可覆盖
+func grpcWebCORSOptions() []interceptors.CORSOption {
+	return []interceptors.CORSOption{
+		interceptors.WithAllowedMethods(http.MethodPost),
+		interceptors.WithAllowedHeaders(
+			"Authorization", "Content-Type", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent", sessionIdHeader,
+		),
+		interceptors.WithExposedHeaders("Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin", sessionIdHeader),
+	}
+}
+
+func isGrpcWebRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// isGrpcWebPreflight 请求注册的 grpc 方法的 CORS 预检请求
+func (s *Webserver) isGrpcWebPreflight(r *http.Request) bool {
+	if r.Method != http.MethodOptions || len(r.Header.Get("Access-Control-Request-Method")) < 1 {
+		return false
+	}
+	// /package.Service/Method
+	service, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok {
+		return false
+	}
+	info, ok := s.grpcSrv.GetServiceInfo()[service]
+	if !ok {
+		return false
+	}
+	for _, m := range info.Methods {
+		if m.Name == method {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcWebHandler 将 grpc-web 请求转换为 grpc 请求交给 grpcSrv，trailer 写入响应 body
+func (s *Webserver) grpcWebHandler() http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		text := strings.HasPrefix(contentType, grpcWebTextContentType)
+		// application/grpc-web+proto -> application/grpc+proto
+		subtype := strings.TrimPrefix(strings.TrimPrefix(contentType, grpcWebTextContentType), grpcWebContentType)
+
+		req := r.Clone(r.Context())
+		req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+		req.Header.Set("Content-Type", "application/grpc"+subtype)
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		if text {
+			req.Body = io.NopCloser(&base64Reader{r: r.Body})
+		}
+
+		ww := &grpcWebResponseWriter{
+			w:           w,
+			header:      make(http.Header),
+			text:        text,
+			contentType: contentType,
+		}
+		s.grpcSrv.ServeHTTP(ww, req)
+		ww.finish()
+	})
+	opts := append(grpcWebCORSOptions(), s.grpcWebCORSOptions...)
+	return interceptors.HttpMiddlewareOfCORS(opts...)(handler)
+}
+
+// grpcWebResponseWriter grpcSrv 写入的 trailer 编码为 body 中的 trailer frame，text 模式下 body 使用 base64 编码
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	text        bool
+	contentType string
+	wroteHeader bool
+}
+
+func (w *grpcWebResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcWebResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	declared := w.declaredTrailers()
+	h := w.w.Header()
+	for k, vv := range w.header {
+		if k == "Trailer" || declared[k] || strings.HasPrefix(k, http2.TrailerPrefix) {
+			continue
+		}
+		h[k] = vv
+	}
+	h.Set("Content-Type", w.contentType)
+	w.w.WriteHeader(code)
+}
+
+func (w *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.text {
+		return w.w.Write(b)
+	}
+	// 每次写入单独编码，grpc-web 客户端按 4 字节一组解码带 padding 的 base64
+	if _, err := w.w.Write([]byte(base64.StdEncoding.EncodeToString(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *grpcWebResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// declaredTrailers 通过 Trailer 响应头声明的 trailer，如 Grpc-Status
+func (w *grpcWebResponseWriter) declaredTrailers() map[string]bool {
+	declared := make(map[string]bool)
+	for _, v := range w.header.Values("Trailer") {
+		for _, k := range strings.Split(v, ",") {
+			declared[http.CanonicalHeaderKey(strings.TrimSpace(k))] = true
+		}
+	}
+	return declared
+}
+
+// finish 写入 trailer frame，key 使用小写
+func (w *grpcWebResponseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	trailer := make(http.Header)
+	for k := range w.declaredTrailers() {
+		for _, v := range w.header.Values(k) {
+			trailer.Add(k, v)
+		}
+	}
+	for k, vv := range w.header {
+		if strings.HasPrefix(k, http2.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http2.TrailerPrefix))] = vv
+		}
+	}
+	if len(trailer) < 1 {
+		return
+	}
+
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var payload bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			payload.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+payload.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(payload.Len()))
+	_, _ = w.Write(append(frame, payload.Bytes()...))
+	w.Flush()
+}
+
+// base64Reader grpc-web-text 的请求 body 可能由多段带 padding 的 base64 拼接而成
+type base64Reader struct {
+	r       io.Reader
+	in      [4096]byte
+	pending []byte // 不足 4 字节的输入
+	out     []byte // 已解码未读取的数据
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.out) < 1 {
+		m := copy(b.in[:], b.pending)
+		n, err := b.r.Read(b.in[m:])
+		if n > 0 {
+			if err := b.decode(b.in[:m+n]); err != nil {
+				return 0, err
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(b.pending) > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if len(b.out) < 1 {
+				return 0, err
+			}
+		}
+	}
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+// decode 按 4 字节一组解码，遇到 padding 时分段
+func (b *base64Reader) decode(in []byte) error {
+	size := len(in) / 4 * 4
+	out := make([]byte, 0, size/4*3)
+	for start := 0; start < size; {
+		end := size
+		if i := bytes.IndexByte(in[start:size], '='); i >= 0 {
+			end = start + (i/4+1)*4
+		}
+		buf := make([]byte, base64.StdEncoding.DecodedLen(end-start))
+		n, err := base64.StdEncoding.Decode(buf, in[start:end])
+		if err != nil {
+			return err
+		}
+		out = append(out, buf[:n]...)
+		start = end
+	}
+	b.pending = append(b.pending[:0], in[size:]...)
+	b.out = out
+	return nil
+}
@@ -1,6 +1,19 @@
 package webserver
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/limingyao/excellent-go/encoding"
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	pb "google.golang.org/grpc/health/grpc_health_v1"
@@ -15,21 +28,263 @@ const (
 	ServiceUnknownStatus = HealthStatus(pb.HealthCheckResponse_SERVICE_UNKNOWN)
 )
 
+func (s HealthStatus) String() string {
+	return pb.HealthCheckResponse_ServingStatus(s).String()
+}
+
+// Checker 就绪检查，返回 error 表示依赖不可用，服务不再接收流量
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// defaultHealthz 最后一个开启 WithHealthz 的 Webserver，用于兼容包级别的 SetServerStatus
+var defaultHealthz atomic.Pointer[healthz]
+
+// healthz 每个 Webserver 独立的健康状态
 // https://github.com/grpc-ecosystem/grpc-health-probe
-var healthServer *health.Server
+type healthz struct {
+	server *health.Server
 
-func newHealthClient(cc grpc.ClientConnInterface) pb.HealthClient {
-	return pb.NewHealthClient(cc)
+	mu           sync.Mutex
+	serverStatus HealthStatus       // SetServerStatus 设置的状态
+	checkers     map[string]Checker // 就绪检查
+	results      map[string]error   // 就绪检查结果
+	checked      bool               // 是否已完成首次就绪检查
 }
 
-func registerHealthServer(svr grpc.ServiceRegistrar) {
-	healthServer = health.NewServer()
-	pb.RegisterHealthServer(svr, healthServer)
+func newHealthz() *healthz {
+	return &healthz{
+		server:       health.NewServer(),
+		serverStatus: ServingStatus,
+		checkers:     make(map[string]Checker),
+		results:      make(map[string]error),
+	}
 }
 
-func SetServerStatus(status HealthStatus) {
-	if healthServer == nil {
+// update 汇总 SetServerStatus 的状态和就绪检查结果
+func (h *healthz) update() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.serverStatus
+	if len(h.checkers) > 0 && !h.checked {
+		status = NotServingStatus
+	}
+	for _, err := range h.results {
+		if err != nil {
+			status = NotServingStatus
+		}
+	}
+	h.server.SetServingStatus("", pb.HealthCheckResponse_ServingStatus(status))
+}
+
+func (h *healthz) setServerStatus(status HealthStatus) {
+	h.mu.Lock()
+	h.serverStatus = status
+	h.mu.Unlock()
+
+	h.update()
+}
+
+func (h *healthz) setServiceStatus(service string, status HealthStatus) {
+	if len(service) < 1 {
+		h.setServerStatus(status)
 		return
 	}
-	healthServer.SetServingStatus("", pb.HealthCheckResponse_ServingStatus(status))
+	h.server.SetServingStatus(service, pb.HealthCheckResponse_ServingStatus(status))
+}
+
+func (h *healthz) status(ctx context.Context, service string) HealthStatus {
+	resp, err := h.server.Check(ctx, &pb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return ServiceUnknownStatus
+	}
+	return HealthStatus(resp.GetStatus())
+}
+
+// check 并发执行所有就绪检查
+func (h *healthz) check(ctx context.Context, timeout time.Duration) {
+	h.mu.Lock()
+	checkers := make(map[string]Checker, len(h.checkers))
+	for name, checker := range h.checkers {
+		checkers[name] = checker
+	}
+	h.mu.Unlock()
+
+	results := make(map[string]error, len(checkers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := checker.Check(cctx)
+			if err != nil {
+				log.WithError(err).Warnf("readiness check %s fail", name)
+			}
+
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, checker)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	h.results = results
+	h.checked = true
+	h.mu.Unlock()
+
+	h.update()
+}
+
+// watch 定时执行就绪检查，直到 ctx 结束
+func (h *healthz) watch(ctx context.Context, interval, timeout time.Duration) {
+	h.check(ctx, timeout)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.check(ctx, timeout)
+		}
+	}
+}
+
+type readyzResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// livez 进程存活即返回 200
+func (h *healthz) livez(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", encoding.MIMEPlain)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyz 服务状态为 SERVING 时返回 200，否则返回 503，?service= 查询指定服务的状态
+func (h *healthz) readyz(w http.ResponseWriter, r *http.Request) {
+	status := h.status(r.Context(), r.URL.Query().Get("service"))
+
+	resp := readyzResponse{Status: status.String()}
+	h.mu.Lock()
+	names := make([]string, 0, len(h.results))
+	for name := range h.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		resp.Checks = make(map[string]string, len(names))
+	}
+	for _, name := range names {
+		if err := h.results[name]; err != nil {
+			resp.Checks[name] = err.Error()
+		} else {
+			resp.Checks[name] = "ok"
+		}
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", encoding.MIMEJSON)
+	if status != ServingStatus {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Webserver) registerHealthServer() error {
+	pb.RegisterHealthServer(s.internalGrpcServer(), s.healthz.server)
+	s.internalMux().HandleFunc(s.livezPath, s.healthz.livez)
+	s.internalMux().HandleFunc(s.readyzPath, s.healthz.readyz)
+	if s.admin != nil {
+		s.registerAdminHealthEndpoint()
+	} else if err := s.registerHealthEndpoint(); err != nil {
+		return err
+	}
+
+	defaultHealthz.Store(s.healthz)
+	s.healthz.update()
+	go s.healthz.watch(s.ctx, s.readinessInterval, s.readinessTimeout)
+
+	return nil
+}
+
+// registerHealthEndpoint gateway 通过 loopback 连接调用健康检查
+func (s *Webserver) registerHealthEndpoint() error {
+	endpoint := s.endpoint()
+	cc, err := grpc.Dial(endpoint, s.loopbackDialOptions()...)
+	if err != nil {
+		return &RegisterError{Endpoint: endpoint, Err: err}
+	}
+	go func() {
+		<-s.ctx.Done()
+		_ = cc.Close()
+	}()
+
+	runtime.WithHealthEndpointAt(pb.NewHealthClient(cc), s.healthzPath)(s.gatewayMux)
+	return nil
+}
+
+// SetServerStatus 设置服务整体状态，就绪检查失败时整体状态为 NOT_SERVING
+func (s *Webserver) SetServerStatus(status HealthStatus) {
+	s.healthz.setServerStatus(status)
+}
+
+// SetServerStatus 设置最后一个开启 WithHealthz 的 Webserver 的整体状态
+//
+// Deprecated: 使用 Webserver.SetServerStatus
+func SetServerStatus(status HealthStatus) {
+	if h := defaultHealthz.Load(); h != nil {
+		h.setServerStatus(status)
+	}
+}
+
+// SetServiceStatus 设置指定服务的状态，service 为空时等同于 SetServerStatus
+func (s *Webserver) SetServiceStatus(service string, status HealthStatus) {
+	s.healthz.setServiceStatus(service, status)
+}
+
+// AddReadinessChecker 添加就绪检查，需要开启 WithHealthz
+func (s *Webserver) AddReadinessChecker(name string, checker Checker) {
+	s.healthz.mu.Lock()
+	defer s.healthz.mu.Unlock()
+	s.healthz.checkers[name] = checker
+}
+
+// PingChecker 通过 PingContext 检查依赖，如 mysql 的 *sql.DB, *sqlx.DB
+func PingChecker(pinger interface {
+	PingContext(ctx context.Context) error
+}) Checker {
+	return CheckerFunc(pinger.PingContext)
+}
+
+// DialChecker 检查 tcp 地址是否可连接，任意一个地址可连接即成功，如 kafka broker 列表，没有地址时检查失败
+func DialChecker(addrs ...string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if len(addrs) < 1 {
+			return errors.New("no address to dial")
+		}
+		var dialer net.Dialer
+		var err error
+		for _, addr := range addrs {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+				return conn.Close()
+			}
+		}
+		return err
+	})
 }
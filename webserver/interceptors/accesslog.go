@@ -0,0 +1,283 @@
+package interceptors
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/limingyao/excellent-go/encoding/prototext"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type AccessLogLevel int
+
+const (
+	AccessLogNone    AccessLogLevel = iota // 不打印
+	AccessLogBasic                         // 打印方法、错误码、耗时、大小等
+	AccessLogPayload                       // 额外打印脱敏后的请求和响应
+)
+
+const redactedValue = "***"
+
+type accessLogOptions struct {
+	sampleRate    float64                   // 成功请求的采样率，失败和慢请求总是打印
+	level         AccessLogLevel            // 默认级别
+	methodLevels  map[string]AccessLogLevel // 按方法的级别，规则同 WithPublicMethods
+	slowThreshold time.Duration             // 慢请求阈值，超过时打印请求和响应
+	redactFields  map[protoreflect.Name]bool
+	redactOption  protoreflect.ExtensionType // bool 类型的字段 option，为 true 时脱敏
+}
+
+type AccessLogOption func(*accessLogOptions)
+
+// WithSampleRate 成功请求的采样率 [0, 1]，默认 1
+func WithSampleRate(rate float64) AccessLogOption {
+	return func(o *accessLogOptions) {
+		o.sampleRate = rate
+	}
+}
+
+// WithAccessLogLevel 默认级别，默认 AccessLogBasic
+func WithAccessLogLevel(level AccessLogLevel) AccessLogOption {
+	return func(o *accessLogOptions) {
+		o.level = level
+	}
+}
+
+// WithMethodLevel 按方法设置级别，method 以 / 结尾时匹配整个服务
+func WithMethodLevel(method string, level AccessLogLevel) AccessLogOption {
+	return func(o *accessLogOptions) {
+		o.methodLevels[method] = level
+	}
+}
+
+// WithSlowThreshold 超过 threshold 的请求打印 warn 日志和请求响应
+func WithSlowThreshold(threshold time.Duration) AccessLogOption {
+	return func(o *accessLogOptions) {
+		o.slowThreshold = threshold
+	}
+}
+
+// WithRedactFields 需要脱敏的 proto 字段名，如 password, token
+func WithRedactFields(names ...string) AccessLogOption {
+	return func(o *accessLogOptions) {
+		for _, name := range names {
+			o.redactFields[protoreflect.Name(name)] = true
+		}
+	}
+}
+
+// WithRedactOption 通过自定义字段 option 脱敏，如 string password = 1 [(sensitive) = true];
+func WithRedactOption(ext protoreflect.ExtensionType) AccessLogOption {
+	return func(o *accessLogOptions) {
+		o.redactOption = ext
+	}
+}
+
+func newAccessLogOptions(opts ...AccessLogOption) accessLogOptions {
+	o := accessLogOptions{
+		sampleRate:   1,
+		level:        AccessLogBasic,
+		methodLevels: make(map[string]AccessLogLevel),
+		redactFields: make(map[protoreflect.Name]bool),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o accessLogOptions) methodLevel(method string) AccessLogLevel {
+	level := o.level
+	matched := ""
+	// 最长匹配优先
+	for pattern, l := range o.methodLevels {
+		if matchMethod(pattern, method) && len(pattern) > len(matched) {
+			level, matched = l, pattern
+		}
+	}
+	return level
+}
+
+func (o accessLogOptions) redacted(fd protoreflect.FieldDescriptor) bool {
+	if o.redactFields[fd.Name()] {
+		return true
+	}
+	if o.redactOption == nil || fd.Options() == nil {
+		return false
+	}
+	if !protov2.HasExtension(fd.Options(), o.redactOption) {
+		return false
+	}
+	redact, _ := protov2.GetExtension(fd.Options(), o.redactOption).(bool)
+	return redact
+}
+
+// redact 递归脱敏，字符串替换为 ***，其他类型清空
+func (o accessLogOptions) redact(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case o.redacted(fd):
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				m.Set(fd, protoreflect.ValueOfString(redactedValue))
+			} else {
+				m.Clear(fd)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					o.redact(v.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := 0; i < v.List().Len(); i++ {
+					o.redact(v.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			o.redact(v.Message())
+		}
+		return true
+	})
+}
+
+func (o accessLogOptions) payload(msg interface{}) string {
+	m, ok := msg.(proto.Message)
+	if !ok || m == nil {
+		return ""
+	}
+	if len(o.redactFields) > 0 || o.redactOption != nil {
+		m = proto.Clone(m)
+		o.redact(proto.MessageReflect(m))
+	}
+	return strings.TrimSpace(prototext.CompactTextString(m))
+}
+
+func messageSize(msg interface{}) int {
+	if m, ok := msg.(proto.Message); ok && m != nil {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+type accessLog struct {
+	method   string
+	start    time.Time
+	reqSize  int
+	respSize int
+	req      interface{}
+	resp     interface{}
+}
+
+func (o accessLogOptions) print(ctx context.Context, a accessLog, err error) {
+	level := o.methodLevel(a.method)
+	if level == AccessLogNone {
+		return
+	}
+
+	cost := time.Since(a.start)
+	slow := o.slowThreshold > 0 && cost >= o.slowThreshold
+	code := status.Code(err)
+	if code == codes.OK && !slow && o.sampleRate < 1 && rand.Float64() >= o.sampleRate {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		CtxSessionIdKey: SessionIDFromContext(ctx),
+		CtxClientKey:    ClientIPFromContext(ctx),
+		"method":        a.method,
+		"code":          code.String(),
+		"cost":          cost,
+		"req_size":      a.reqSize,
+		"resp_size":     a.respSize,
+	})
+	if level == AccessLogPayload || slow {
+		if a.req != nil {
+			logger = logger.WithField("request", o.payload(a.req))
+		}
+		if a.resp != nil && err == nil {
+			logger = logger.WithField("response", o.payload(a.resp))
+		}
+	}
+	if err != nil {
+		logger = logger.WithError(err)
+	}
+
+	switch {
+	case slow:
+		logger.Warn("slow call")
+	case code == codes.Internal || code == codes.Unknown || code == codes.DataLoss:
+		logger.Error("access")
+	default:
+		logger.Info("access")
+	}
+}
+
+// UnaryServerInterceptorOfAccessLog 每个请求打印一行访问日志，生产环境替代 OfDebug
+func UnaryServerInterceptorOfAccessLog(opts ...AccessLogOption) grpc.UnaryServerInterceptor {
+	o := newAccessLogOptions(opts...)
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		a := accessLog{method: info.FullMethod, start: time.Now(), reqSize: messageSize(req), req: req}
+
+		resp, err = handler(ctx, req)
+
+		if err == nil {
+			a.respSize, a.resp = messageSize(resp), resp
+		}
+		o.print(ctx, a, err)
+		return resp, err
+	}
+}
+
+// accessLogServerStream 统计收发消息的大小
+type accessLogServerStream struct {
+	grpc.ServerStream
+	reqSize  int
+	respSize int
+}
+
+func (s *accessLogServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.reqSize += messageSize(m)
+	}
+	return err
+}
+
+func (s *accessLogServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.respSize += messageSize(m)
+	}
+	return err
+}
+
+// StreamServerInterceptorOfAccessLog 每个 stream 结束时打印一行访问日志，大小为所有消息之和，不打印消息内容
+func StreamServerInterceptorOfAccessLog(opts ...AccessLogOption) grpc.StreamServerInterceptor {
+	o := newAccessLogOptions(opts...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &accessLogServerStream{ServerStream: ss}
+
+		err := handler(srv, stream)
+
+		o.print(ss.Context(), accessLog{
+			method:   info.FullMethod,
+			start:    start,
+			reqSize:  stream.reqSize,
+			respSize: stream.respSize,
+		}, err)
+		return err
+	}
+}
@@ -0,0 +1,60 @@
+package interceptors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+func TestAccessLog(t *testing.T) {
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			if req.Value == "slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return req, nil
+		},
+	}, []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfAccessLog(
+		interceptors.WithSampleRate(0),
+		interceptors.WithSlowThreshold(10*time.Millisecond),
+		interceptors.WithRedactFields("value"),
+	))})
+
+	// 采样率为 0 时成功请求不打印
+	if _, err := client.Echo(context.Background(), &pb.Message{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("unexpected entries %d", len(hook.AllEntries()))
+	}
+
+	// 慢请求打印脱敏后的请求和响应
+	if _, err := client.Echo(context.Background(), &pb.Message{Value: "slow"}); err != nil {
+		t.Fatal(err)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.WarnLevel {
+		t.Fatalf("expect warn entry, got %v", entry)
+	}
+	for key, expect := range map[string]interface{}{
+		"method":    "/internal.proto.EchoService/Echo",
+		"code":      "OK",
+		"request":   `value:"***"`,
+		"response":  `value:"***"`,
+		"req_size":  6,
+		"resp_size": 6,
+	} {
+		if entry.Data[key] != expect {
+			t.Errorf("%s: expect %v, got %v", key, expect, entry.Data[key])
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metadataAuthorizationKey = "authorization" // gateway 会转发 Authorization header
+
+	SchemeBearer = "Bearer" // jwt
+	SchemeApiKey = "ApiKey" // 静态 api key
+	SchemeTOTP   = "TOTP"   // 动态码，格式 user:code
+)
+
+// Principal 认证主体
+type Principal struct {
+	Subject string                 // 用户或应用标识
+	Scheme  string                 // 认证方式
+	Claims  map[string]interface{} // jwt claims
+}
+
+// Verifier 校验 authorization 中的凭证，校验失败返回 error
+type Verifier interface {
+	Verify(ctx context.Context, credentials string) (*Principal, error)
+}
+
+type VerifierFunc func(ctx context.Context, credentials string) (*Principal, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, credentials string) (*Principal, error) {
+	return f(ctx, credentials)
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext 获取认证主体
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// WithPrincipal 设置认证主体
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+type authOptions struct {
+	verifiers     map[string]Verifier // scheme 小写 -> verifier
+	publicMethods []string            // 不需要认证的方法
+	methodSchemes map[string][]string // 方法允许的 scheme
+}
+
+type AuthOption func(*authOptions)
+
+// WithVerifier 注册 scheme 对应的 verifier，如 SchemeBearer, SchemeApiKey, SchemeTOTP
+func WithVerifier(scheme string, verifier Verifier) AuthOption {
+	return func(o *authOptions) {
+		o.verifiers[strings.ToLower(scheme)] = verifier
+	}
+}
+
+// WithPublicMethods 不需要认证的方法，以 / 结尾时匹配整个服务，如 /grpc.health.v1.Health/
+func WithPublicMethods(methods ...string) AuthOption {
+	return func(o *authOptions) {
+		o.publicMethods = append(o.publicMethods, methods...)
+	}
+}
+
+// WithMethodSchemes 限制方法允许的 scheme，如管理接口只允许 SchemeTOTP，规则同 WithPublicMethods
+func WithMethodSchemes(method string, schemes ...string) AuthOption {
+	return func(o *authOptions) {
+		o.methodSchemes[method] = schemes
+	}
+}
+
+type authenticator struct {
+	opts authOptions
+}
+
+func newAuthenticator(opts ...AuthOption) *authenticator {
+	o := authOptions{
+		verifiers: make(map[string]Verifier),
+		publicMethods: []string{
+			"/grpc.health.v1.Health/",
+			"/grpc.reflection.v1.ServerReflection/",
+			"/grpc.reflection.v1alpha.ServerReflection/",
+		},
+		methodSchemes: make(map[string][]string),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &authenticator{opts: o}
+}
+
+// matchMethod pattern 以 / 结尾时按服务前缀匹配
+func matchMethod(pattern, fullMethod string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(fullMethod, pattern)
+	}
+	return pattern == fullMethod
+}
+
+func (a *authenticator) public(fullMethod string) bool {
+	for _, pattern := range a.opts.publicMethods {
+		if matchMethod(pattern, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed 最长匹配优先，精确匹配的方法优先于服务前缀，没有匹配的规则时允许所有 scheme
+func (a *authenticator) allowed(fullMethod, scheme string) bool {
+	var schemes []string
+	matched := ""
+	for pattern, s := range a.opts.methodSchemes {
+		if matchMethod(pattern, fullMethod) && len(pattern) > len(matched) {
+			schemes, matched = s, pattern
+		}
+	}
+	if len(matched) < 1 {
+		return true
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.public(fullMethod) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(metadataAuthorizationKey)
+	if len(values) < 1 || len(values[0]) < 1 {
+		return nil, status.Errorf(codes.Unauthenticated, "%s", "missing authorization")
+	}
+
+	scheme, credentials, ok := strings.Cut(values[0], " ")
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "%s", "invalid authorization")
+	}
+	verifier, ok := a.opts.verifiers[strings.ToLower(scheme)]
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "unsupported authorization scheme %s", scheme)
+	}
+	if !a.allowed(fullMethod, scheme) {
+		return nil, status.Errorf(codes.PermissionDenied, "authorization scheme %s not allowed", scheme)
+	}
+
+	principal, err := verifier.Verify(ctx, strings.TrimSpace(credentials))
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "%s", err)
+	}
+	if principal == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "%s", "invalid credentials")
+	}
+	if len(principal.Scheme) < 1 {
+		principal.Scheme = scheme
+	}
+	return WithPrincipal(ctx, principal), nil
+}
+
+// UnaryServerInterceptorOfAuth 校验 authorization metadata，认证主体通过 PrincipalFromContext 获取，
+// health, reflection 默认不需要认证
+func UnaryServerInterceptorOfAuth(opts ...AuthOption) grpc.UnaryServerInterceptor {
+	a := newAuthenticator(opts...)
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, err = a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptorOfAuth 校验 authorization metadata，认证主体通过 PrincipalFromContext 获取
+func StreamServerInterceptorOfAuth(opts ...AuthOption) grpc.StreamServerInterceptor {
+	a := newAuthenticator(opts...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
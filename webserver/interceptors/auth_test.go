@@ -0,0 +1,239 @@
+package interceptors_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/pkg/crypto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T) {
+	secret := []byte("secret")
+	newClient := func(opts ...interceptors.AuthOption) pb.EchoServiceClient {
+		return newEchoClient(t, &echoService{
+			echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+				if principal, ok := interceptors.PrincipalFromContext(ctx); ok {
+					return &pb.Message{Value: principal.Subject}, nil
+				}
+				return &pb.Message{}, nil
+			},
+		}, []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfAuth(opts...))})
+	}
+	client := newClient(
+		interceptors.WithVerifier(interceptors.SchemeBearer, interceptors.HMACVerifier(secret)),
+		interceptors.WithVerifier(interceptors.SchemeApiKey, interceptors.ApiKeyVerifier(map[string]string{"key": "app"})),
+	)
+	call := func(client pb.EchoServiceClient, authorization string) (string, error) {
+		ctx := context.Background()
+		if len(authorization) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+		}
+		resp, err := client.Echo(ctx, &pb.Message{})
+		return resp.GetValue(), err
+	}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(secret)
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}).SignedString(secret)
+
+	for _, c := range []struct {
+		authorization string
+		subject       string
+		code          codes.Code
+	}{
+		{"", "", codes.Unauthenticated},
+		{"Bearer " + token, "user", codes.OK},
+		{"Bearer " + expired, "", codes.Unauthenticated},
+		{"ApiKey key", "app", codes.OK},
+		{"ApiKey bad", "", codes.Unauthenticated},
+		{"Basic xxx", "", codes.Unauthenticated},
+	} {
+		subject, err := call(client, c.authorization)
+		if status.Code(err) != c.code || subject != c.subject {
+			t.Errorf("%q: expect %s %s, got %q %v", c.authorization, c.code, c.subject, subject, err)
+		}
+	}
+
+	// 管理接口只允许 totp
+	g := crypto.NewGoogleAuth()
+	totpSecret, _ := g.GetSecret()
+	admin := newClient(
+		interceptors.WithVerifier(interceptors.SchemeApiKey, interceptors.ApiKeyVerifier(map[string]string{"key": "app"})),
+		interceptors.WithVerifier(interceptors.SchemeTOTP, interceptors.TOTPVerifier(map[string]string{"admin": totpSecret})),
+		interceptors.WithMethodSchemes("/internal.proto.EchoService/", interceptors.SchemeTOTP),
+	)
+	if _, err := call(admin, "ApiKey key"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expect PermissionDenied, got %v", err)
+	}
+	code, _ := g.GetCode(totpSecret)
+	if subject, err := call(admin, "TOTP admin:"+code); err != nil || subject != "admin" {
+		t.Errorf("expect admin, got %q %v", subject, err)
+	}
+
+	// 公开方法不需要认证
+	public := newClient(interceptors.WithPublicMethods("/internal.proto.EchoService/Echo"))
+	if _, err := call(public, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func authCall(t *testing.T, opts []interceptors.AuthOption, authorization string) (string, error) {
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			principal, _ := interceptors.PrincipalFromContext(ctx)
+			return &pb.Message{Value: principal.Subject}, nil
+		},
+	}, []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfAuth(opts...))})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", authorization)
+	resp, err := client.Echo(ctx, &pb.Message{})
+	return resp.GetValue(), err
+}
+
+func TestAuthMethodSchemes(t *testing.T) {
+	g := crypto.NewGoogleAuth()
+	totpSecret, _ := g.GetSecret()
+	opts := []interceptors.AuthOption{
+		interceptors.WithVerifier(interceptors.SchemeApiKey, interceptors.ApiKeyVerifier(map[string]string{"key": "app"})),
+		interceptors.WithVerifier(interceptors.SchemeTOTP, interceptors.TOTPVerifier(map[string]string{"admin": totpSecret})),
+		// 精确匹配的方法优先于服务前缀
+		interceptors.WithMethodSchemes("/internal.proto.EchoService/", interceptors.SchemeApiKey),
+		interceptors.WithMethodSchemes("/internal.proto.EchoService/Echo", interceptors.SchemeTOTP),
+	}
+	// map 的遍历顺序随机，多次请求结果必须一致
+	for i := 0; i < 20; i++ {
+		if _, err := authCall(t, opts, "ApiKey key"); status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expect PermissionDenied, got %v", err)
+		}
+	}
+	code, _ := g.GetCode(totpSecret)
+	if subject, err := authCall(t, opts, "TOTP admin:"+code); err != nil || subject != "admin" {
+		t.Errorf("expect admin, got %q %v", subject, err)
+	}
+}
+
+func TestAuthNilPrincipal(t *testing.T) {
+	opts := []interceptors.AuthOption{
+		interceptors.WithVerifier(interceptors.SchemeApiKey, interceptors.VerifierFunc(
+			func(context.Context, string) (*interceptors.Principal, error) {
+				return nil, nil
+			},
+		)),
+	}
+	if _, err := authCall(t, opts, "ApiKey key"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expect Unauthenticated, got %v", err)
+	}
+}
+
+func TestRSAVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "user", "iss": "issuer", "exp": time.Now().Add(time.Minute).Unix()}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(other)
+
+	verifier := interceptors.RSAVerifier(&key.PublicKey, interceptors.WithJWTIssuer("issuer"))
+	principal, err := verifier.Verify(context.Background(), token)
+	if err != nil || principal.Subject != "user" || principal.Scheme != interceptors.SchemeBearer {
+		t.Errorf("unexpected principal %+v %v", principal, err)
+	}
+	if _, err := verifier.Verify(context.Background(), forged); err == nil {
+		t.Error("expect forged token rejected")
+	}
+	wrongIssuer := interceptors.RSAVerifier(&key.PublicKey, interceptors.WithJWTIssuer("other"))
+	if _, err := wrongIssuer.Verify(context.Background(), token); err == nil {
+		t.Error("expect issuer mismatch rejected")
+	}
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA",
+			"kid": "rsa",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+		{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(secret)},
+	}}
+	b, _ := json.Marshal(jwks)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := interceptors.JWKSVerifier(file, interceptors.WithJWTAudience("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, audience string) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"sub": kid,
+			"aud": audience,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	// 使用 rsa 公钥作为 hmac 密钥签名
+	publicKey := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+
+	for _, c := range []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"rsa", sign(jwt.SigningMethodRS256, "rsa", key, "api"), true},
+		{"hmac", sign(jwt.SigningMethodHS256, "hmac", secret, "api"), true},
+		{"audience", sign(jwt.SigningMethodRS256, "rsa", key, "other"), false},
+		{"unknown kid", sign(jwt.SigningMethodHS256, "unknown", secret, "api"), false},
+		{"algorithm confusion", sign(jwt.SigningMethodHS256, "rsa", publicKey, "api"), false},
+	} {
+		principal, err := verifier.Verify(context.Background(), c.token)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: expect ok %v, got %v", c.name, c.ok, err)
+		}
+		if c.ok && principal.Subject != c.name {
+			t.Errorf("%s: unexpected principal %+v", c.name, principal)
+		}
+	}
+
+	if _, err := interceptors.JWKSVerifier(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expect missing jwks file error")
+	}
+}
@@ -0,0 +1,179 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/limingyao/excellent-go/pkg/crypto"
+)
+
+type jwtOptions struct {
+	issuer   string
+	audience string
+}
+
+type JWTOption func(*jwtOptions)
+
+// WithJWTIssuer 校验 iss
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(o *jwtOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithJWTAudience 校验 aud
+func WithJWTAudience(audience string) JWTOption {
+	return func(o *jwtOptions) {
+		o.audience = audience
+	}
+}
+
+type jwtVerifier struct {
+	keyFunc jwt.Keyfunc
+	parser  *jwt.Parser
+}
+
+func newJWTVerifier(keyFunc jwt.Keyfunc, methods []string, opts ...JWTOption) *jwtVerifier {
+	o := jwtOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	parserOpts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if len(o.issuer) > 0 {
+		parserOpts = append(parserOpts, jwt.WithIssuer(o.issuer))
+	}
+	if len(o.audience) > 0 {
+		parserOpts = append(parserOpts, jwt.WithAudience(o.audience))
+	}
+	return &jwtVerifier{keyFunc: keyFunc, parser: jwt.NewParser(parserOpts...)}
+}
+
+func (v *jwtVerifier) Verify(_ context.Context, credentials string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(credentials, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+	subject, _ := claims.GetSubject()
+	return &Principal{Subject: subject, Scheme: SchemeBearer, Claims: claims}, nil
+}
+
+// HMACVerifier HS256/HS384/HS512 签名的 jwt
+func HMACVerifier(secret []byte, opts ...JWTOption) Verifier {
+	return newJWTVerifier(func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, []string{"HS256", "HS384", "HS512"}, opts...)
+}
+
+// RSAVerifier RS256/RS384/RS512 签名的 jwt
+func RSAVerifier(key *rsa.PublicKey, opts ...JWTOption) Verifier {
+	return newJWTVerifier(func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}, []string{"RS256", "RS384", "RS512"}, opts...)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// parseJWK 支持 RSA 公钥和 oct 对称密钥
+func parseJWK(key jwk) (interface{}, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(key.K)
+	default:
+		return nil, fmt.Errorf("unsupported jwk kty %s", key.Kty)
+	}
+}
+
+// JWKSVerifier 从 jwks 文件加载密钥，按 jwt header 中的 kid 选择密钥
+func JWKSVerifier(jwksFile string, opts ...JWTOption) (Verifier, error) {
+	data, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		k, err := parseJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[key.Kid] = k
+	}
+
+	return newJWTVerifier(func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %s", kid)
+		}
+		// 防止使用公钥作为 hmac 密钥
+		if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); isHMAC {
+			if _, ok := key.([]byte); !ok {
+				return nil, fmt.Errorf("kid %s is not a hmac key", kid)
+			}
+		}
+		return key, nil
+	}, []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512"}, opts...), nil
+}
+
+// ApiKeyVerifier 静态 api key，keys 为 api key -> subject
+func ApiKeyVerifier(keys map[string]string) Verifier {
+	return VerifierFunc(func(_ context.Context, credentials string) (*Principal, error) {
+		for key, subject := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(credentials)) == 1 {
+				return &Principal{Subject: subject, Scheme: SchemeApiKey}, nil
+			}
+		}
+		return nil, errors.New("invalid api key")
+	})
+}
+
+// TOTPVerifier 动态码，凭证格式 user:code，secrets 为 user -> secret
+func TOTPVerifier(secrets map[string]string) Verifier {
+	auth := crypto.NewGoogleAuth()
+	return VerifierFunc(func(_ context.Context, credentials string) (*Principal, error) {
+		user, code, ok := strings.Cut(credentials, ":")
+		if !ok {
+			return nil, errors.New("invalid totp credentials")
+		}
+		secret, ok := secrets[user]
+		if !ok {
+			return nil, errors.New("invalid totp code")
+		}
+		if ok, err := auth.VerifyCode(secret, code); err != nil || !ok {
+			return nil, errors.New("invalid totp code")
+		}
+		return &Principal{Subject: user, Scheme: SchemeTOTP}, nil
+	})
+}
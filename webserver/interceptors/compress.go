@@ -0,0 +1,213 @@
+package interceptors
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// compressor gzip.Writer, brotli.Writer
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var compressorPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	EncodingBrotli: {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+}
+
+type compressOptions struct {
+	minSize   int      // 小于 minSize 的响应不压缩
+	encodings []string // 按优先级排列
+}
+
+type CompressOption func(*compressOptions)
+
+// WithCompressMinSize 响应小于 size 时不压缩，默认 1024
+func WithCompressMinSize(size int) CompressOption {
+	return func(o *compressOptions) {
+		o.minSize = size
+	}
+}
+
+// WithCompressEncodings 支持的压缩算法，按优先级排列，默认 br, gzip
+func WithCompressEncodings(encodings ...string) CompressOption {
+	return func(o *compressOptions) {
+		o.encodings = encodings
+	}
+}
+
+// negotiate 按优先级选择客户端支持的压缩算法，忽略 q=0
+func (o compressOptions) negotiate(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, token := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(token, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		accepted[name] = true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q <= 0 {
+				accepted[name] = false
+			}
+		}
+	}
+	for _, encoding := range o.encodings {
+		if _, ok := compressorPools[encoding]; ok && (accepted[encoding] || accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressResponseWriter 缓存 minSize 的响应后决定是否压缩
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding  string
+	minSize   int
+	code      int
+	buf       []byte
+	committed bool
+	cw        compressor
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.committed || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+	// 没有 body 的响应直接写出
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		_ = w.commit(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.committed {
+		if w.cw != nil {
+			return w.cw.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressResponseWriter) commit(compress bool) error {
+	w.committed = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	h := w.Header()
+	if compress && len(w.buf) > 0 && len(h.Get("Content-Encoding")) < 1 {
+		if len(h.Get("Content-Type")) < 1 {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.cw = compressorPools[w.encoding].Get().(compressor)
+		w.cw.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) < 1 {
+		return nil
+	}
+	if w.cw != nil {
+		_, err := w.cw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush 流式响应，未达到 minSize 时不压缩
+func (w *compressResponseWriter) Flush() {
+	if !w.committed {
+		_ = w.commit(len(w.buf) >= w.minSize)
+	}
+	if w.cw != nil {
+		_ = w.cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) close() error {
+	if !w.committed {
+		if err := w.commit(false); err != nil {
+			return err
+		}
+	}
+	if w.cw == nil {
+		return nil
+	}
+	err := w.cw.Close()
+	w.cw.Reset(io.Discard)
+	compressorPools[w.encoding].Put(w.cw)
+	w.cw = nil
+	return err
+}
+
+// HttpMiddlewareOfCompress 按 Accept-Encoding 压缩响应，支持 gzip 和 br，websocket 等 Upgrade 请求不压缩
+func HttpMiddlewareOfCompress(opts ...CompressOption) HttpMiddleware {
+	o := compressOptions{minSize: 1024, encodings: []string{EncodingBrotli, EncodingGzip}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.Header.Get("Upgrade")) > 0 || r.Method == http.MethodHead {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := o.negotiate(r.Header.Get("Accept-Encoding"))
+			if len(encoding) < 1 {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, minSize: o.minSize}
+			defer func() {
+				_ = cw.close()
+			}()
+			handler.ServeHTTP(cw, r)
+		})
+	}
+}
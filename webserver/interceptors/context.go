@@ -0,0 +1,69 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+type sessionIdKey struct{}
+
+type clientIpKey struct{}
+
+// WithSessionID 设置 session id
+func WithSessionID(ctx context.Context, sessionId string) context.Context {
+	return context.WithValue(ctx, sessionIdKey{}, sessionId)
+}
+
+// SessionIDFromContext 获取 session id，不存在时返回空字符串
+func SessionIDFromContext(ctx context.Context) string {
+	if sessionId, ok := ctx.Value(sessionIdKey{}).(string); ok {
+		return sessionId
+	}
+	// 兼容使用 CtxSessionIdKey 设置的 session id
+	sessionId, _ := ctx.Value(CtxSessionIdKey).(string)
+	return sessionId
+}
+
+// WithClientIP 设置客户端 ip
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIpKey{}, ip)
+}
+
+// ClientIPFromContext 获取客户端 ip，优先使用 X-Forwarded-For 等 metadata 中的 ip，其次使用连接的对端地址，
+// metadata 中的 ip 由 OfContext 写入，使用方需要在 OfContext 之后，否则 gateway 请求返回回环地址
+func ClientIPFromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(clientIpKey{}).(string); ok && len(ip) > 0 {
+		return ip
+	}
+	// 兼容使用 CtxClientKey 设置的 ip
+	if ip, ok := ctx.Value(CtxClientKey).(string); ok && len(ip) > 0 {
+		return ip
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// ContextValuers 日志字段对应的 context 读取函数，用于 logrus.WithContextValuers
+func ContextValuers() map[string]func(ctx context.Context) interface{} {
+	return map[string]func(ctx context.Context) interface{}{
+		CtxSessionIdKey: func(ctx context.Context) interface{} {
+			if sessionId := SessionIDFromContext(ctx); len(sessionId) > 0 {
+				return sessionId
+			}
+			return nil
+		},
+		CtxClientKey: func(ctx context.Context) interface{} {
+			if ip := ClientIPFromContext(ctx); len(ip) > 0 {
+				return ip
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,37 @@
+package interceptors_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc/peer"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if sessionId := interceptors.SessionIDFromContext(ctx); sessionId != "" {
+		t.Errorf("unexpected session id %s", sessionId)
+	}
+	if sessionId := interceptors.SessionIDFromContext(interceptors.WithSessionID(ctx, "session")); sessionId != "session" {
+		t.Errorf("unexpected session id %s", sessionId)
+	}
+
+	// 没有 X-Forwarded-For 等 metadata 时使用对端地址
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	if ip := interceptors.ClientIPFromContext(ctx); ip != "10.0.0.1" {
+		t.Errorf("unexpected client ip %s", ip)
+	}
+	if ip := interceptors.ClientIPFromContext(interceptors.WithClientIP(ctx, "10.0.0.2")); ip != "10.0.0.2" {
+		t.Errorf("unexpected client ip %s", ip)
+	}
+
+	valuers := interceptors.ContextValuers()
+	if v := valuers[interceptors.CtxClientKey](ctx); v != "10.0.0.1" {
+		t.Errorf("unexpected client ip %v", v)
+	}
+	if v := valuers[interceptors.CtxSessionIdKey](ctx); v != nil {
+		t.Errorf("unexpected session id %v", v)
+	}
+}
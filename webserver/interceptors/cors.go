@@ -0,0 +1,196 @@
+package interceptors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type corsOptions struct {
+	origins          []string // * 允许所有，https://*.example.com 允许子域名
+	methods          []string
+	headers          []string // * 允许所有
+	exposedHeaders   []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+type CORSOption func(*corsOptions)
+
+// WithAllowedOrigins 允许的 Origin，* 允许所有，https://*.example.com 允许所有子域名，默认 *
+func WithAllowedOrigins(origins ...string) CORSOption {
+	return func(o *corsOptions) {
+		o.origins = origins
+	}
+}
+
+// WithAllowedMethods 允许的方法，默认 GET, HEAD, POST, PUT, PATCH, DELETE
+func WithAllowedMethods(methods ...string) CORSOption {
+	return func(o *corsOptions) {
+		o.methods = methods
+	}
+}
+
+// WithAllowedHeaders 允许的请求头，* 允许所有，默认 Accept, Authorization, Content-Type, X-Requested-With, X-Session-Id
+func WithAllowedHeaders(headers ...string) CORSOption {
+	return func(o *corsOptions) {
+		o.headers = headers
+	}
+}
+
+// WithExposedHeaders 浏览器可以读取的响应头
+func WithExposedHeaders(headers ...string) CORSOption {
+	return func(o *corsOptions) {
+		o.exposedHeaders = headers
+	}
+}
+
+// WithAllowCredentials 允许携带 cookie，此时 Access-Control-Allow-Origin 返回请求的 Origin
+func WithAllowCredentials() CORSOption {
+	return func(o *corsOptions) {
+		o.allowCredentials = true
+	}
+}
+
+// WithMaxAge 预检请求的缓存时间
+func WithMaxAge(maxAge time.Duration) CORSOption {
+	return func(o *corsOptions) {
+		o.maxAge = maxAge
+	}
+}
+
+func newCORSOptions(opts ...CORSOption) corsOptions {
+	o := corsOptions{
+		origins: []string{"*"},
+		methods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+		headers: []string{"Accept", "Authorization", "Content-Type", "X-Requested-With", metadataSessionIdKey},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o corsOptions) originAllowed(origin string) bool {
+	for _, allowed := range o.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com
+		if i := strings.Index(allowed, "*"); i >= 0 &&
+			len(origin) > len(allowed)-1 &&
+			strings.HasPrefix(origin, allowed[:i]) &&
+			strings.HasSuffix(origin, allowed[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o corsOptions) methodAllowed(method string) bool {
+	if method == http.MethodOptions {
+		return true
+	}
+	for _, allowed := range o.methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o corsOptions) headersAllowed(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if len(header) < 1 {
+			continue
+		}
+		allowed := false
+		for _, h := range o.headers {
+			if h == "*" || strings.EqualFold(h, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func (o corsOptions) allowAll() bool {
+	for _, origin := range o.origins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (o corsOptions) setOrigin(h http.Header, origin string) {
+	if o.allowAll() && !o.allowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if o.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight 不允许的请求不返回 CORS 响应头，由浏览器拒绝
+func (o corsOptions) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	if !o.originAllowed(origin) || !o.methodAllowed(method) || !o.headersAllowed(requested) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	o.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.ToUpper(method))
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if o.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(o.maxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HttpMiddlewareOfCORS 处理跨域请求，OPTIONS 预检请求直接返回，不会交给 handler
+func HttpMiddlewareOfCORS(opts ...CORSOption) HttpMiddleware {
+	o := newCORSOptions(opts...)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if len(origin) < 1 {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+				o.preflight(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if o.originAllowed(origin) {
+				o.setOrigin(w.Header(), origin)
+				if len(o.exposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(o.exposedHeaders, ", "))
+				}
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
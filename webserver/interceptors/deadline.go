@@ -0,0 +1,194 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type deadlineOptions struct {
+	defaultTimeout time.Duration            // 默认超时
+	methodTimeouts map[string]time.Duration // 按方法的超时，key 为 full method: /package.Service/Method
+	margin         time.Duration            // 下游调用预留的时间
+}
+
+type DeadlineOption func(*deadlineOptions)
+
+// WithDefaultTimeout 默认超时，请求没有 deadline 或 deadline 更长时使用
+func WithDefaultTimeout(timeout time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		o.defaultTimeout = timeout
+	}
+}
+
+// WithMethodTimeouts 按方法的超时，覆盖默认超时
+func WithMethodTimeouts(timeouts map[string]time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		for method, timeout := range timeouts {
+			o.methodTimeouts[method] = timeout
+		}
+	}
+}
+
+// WithDeadlineMargin 下游调用的 deadline 提前 margin 结束，预留时间给当前服务处理响应，默认 20ms
+func WithDeadlineMargin(margin time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		o.margin = margin
+	}
+}
+
+func newDeadlineOptions(opts ...DeadlineOption) deadlineOptions {
+	o := deadlineOptions{
+		methodTimeouts: make(map[string]time.Duration),
+		margin:         20 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o deadlineOptions) timeout(method string) time.Duration {
+	if timeout, ok := o.methodTimeouts[method]; ok {
+		return timeout
+	}
+	return o.defaultTimeout
+}
+
+// withTimeout deadline 取请求的 deadline 和配置超时中较早的
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// deadlineExceeded ctx 超时后统一返回 DeadlineExceeded，便于日志和 metrics 统计
+func deadlineExceeded(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		(errors.Is(ctx.Err(), context.DeadlineExceeded) && status.Code(err) != codes.DeadlineExceeded) {
+		err = status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if status.Code(err) == codes.DeadlineExceeded {
+		sessionId := SessionIDFromContext(ctx)
+		log.WithField(CtxSessionIdKey, sessionId).WithField("method", method).WithError(err).Warn("deadline exceeded")
+	}
+	return err
+}
+
+// UnaryServerInterceptorOfDeadline 限制请求的最长处理时间
+func UnaryServerInterceptorOfDeadline(opts ...DeadlineOption) grpc.UnaryServerInterceptor {
+	o := newDeadlineOptions(opts...)
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, cancel := withTimeout(ctx, o.timeout(info.FullMethod))
+		defer cancel()
+
+		resp, err = handler(ctx, req)
+
+		return resp, deadlineExceeded(ctx, info.FullMethod, err)
+	}
+}
+
+// StreamServerInterceptorOfDeadline 限制 stream 的最长处理时间
+func StreamServerInterceptorOfDeadline(opts ...DeadlineOption) grpc.StreamServerInterceptor {
+	o := newDeadlineOptions(opts...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		ctx, cancel := withTimeout(wrapped.WrappedContext, o.timeout(info.FullMethod))
+		defer cancel()
+		wrapped.WrappedContext = ctx
+
+		err := handler(srv, wrapped)
+
+		return deadlineExceeded(ctx, info.FullMethod, err)
+	}
+}
+
+// clientDeadline 下游调用的 deadline 提前 margin，没有 deadline 时使用配置的超时
+func (o deadlineOptions) clientDeadline(ctx context.Context, method string) (context.Context, context.CancelFunc, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		ctx, cancel := withTimeout(ctx, o.timeout(method))
+		return ctx, cancel, nil
+	}
+
+	deadline = deadline.Add(-o.margin)
+	if time.Until(deadline) <= 0 {
+		return nil, nil, status.Errorf(codes.DeadlineExceeded, "%s", "deadline exceeded before call")
+	}
+	if timeout := o.timeout(method); timeout > 0 && time.Until(deadline) > timeout {
+		deadline = time.Now().Add(timeout)
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, cancel, nil
+}
+
+// UnaryClientInterceptorOfDeadline 传递 deadline，预留 margin 给当前服务
+func UnaryClientInterceptorOfDeadline(opts ...DeadlineOption) grpc.UnaryClientInterceptor {
+	o := newDeadlineOptions(opts...)
+	return func(ctx context.Context, method string, req, resp interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		cctx, cancel, err := o.clientDeadline(ctx, method)
+		if err != nil {
+			return deadlineExceeded(ctx, method, err)
+		}
+		defer cancel()
+
+		err = invoker(cctx, method, req, resp, cc, opts...)
+
+		return deadlineExceeded(cctx, method, err)
+	}
+}
+
+// deadlineClientStream 转换 deadline 错误
+type deadlineClientStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	method string
+}
+
+func (s *deadlineClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	return deadlineExceeded(s.ctx, s.method, err)
+}
+
+// StreamClientInterceptorOfDeadline 传递 deadline，预留 margin 给当前服务，stream 结束或 ctx 结束时释放
+func StreamClientInterceptorOfDeadline(opts ...DeadlineOption) grpc.StreamClientInterceptor {
+	o := newDeadlineOptions(opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cctx, cancel, err := o.clientDeadline(ctx, method)
+		if err != nil {
+			return nil, deadlineExceeded(ctx, method, err)
+		}
+
+		// grpc 在流结束或 ctx 结束时调用 OnFinish
+		finish := grpc.OnFinish(func(error) {
+			cancel()
+		})
+		stream, err := streamer(cctx, desc, cc, method, append(opts, finish)...)
+		if err != nil {
+			cancel()
+			return nil, deadlineExceeded(cctx, method, err)
+		}
+		return &deadlineClientStream{ClientStream: stream, ctx: cctx, method: method}, nil
+	}
+}
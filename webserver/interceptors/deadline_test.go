@@ -0,0 +1,102 @@
+package interceptors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadline(t *testing.T) {
+	remaining := make(chan time.Duration, 1)
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			deadline, _ := ctx.Deadline()
+			remaining <- time.Until(deadline)
+			if req.Value == "slow" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return req, nil
+		},
+	}, []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfDeadline(
+		interceptors.WithDefaultTimeout(time.Minute),
+		interceptors.WithMethodTimeouts(map[string]time.Duration{
+			"/internal.proto.EchoService/Echo": 100 * time.Millisecond,
+		}),
+	))}, grpc.WithChainUnaryInterceptor(interceptors.UnaryClientInterceptorOfDeadline(
+		interceptors.WithDeadlineMargin(time.Second),
+	)))
+
+	// 服务端按方法限制超时，handler 返回的 context 错误转换为 DeadlineExceeded
+	if _, err := client.Echo(context.Background(), &pb.Message{Value: "slow"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expect DeadlineExceeded, got %v", err)
+	}
+	if d := <-remaining; d > 100*time.Millisecond {
+		t.Errorf("expect deadline within 100ms, got %v", d)
+	}
+
+	// 客户端预留 margin
+	ctx, cancel := context.WithTimeout(context.Background(), 1050*time.Millisecond)
+	defer cancel()
+	if _, err := client.Echo(ctx, &pb.Message{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := <-remaining; d > 50*time.Millisecond {
+		t.Errorf("expect deadline within 50ms, got %v", d)
+	}
+
+	// 剩余时间不足 margin 时不发起调用
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := client.Echo(ctx, &pb.Message{Value: "a"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expect DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestStreamClientDeadline(t *testing.T) {
+	var streamCtx context.Context
+	cc := newStreamConn(t, func(_ interface{}, ss grpc.ServerStream) error {
+		req := &pb.Message{}
+		if err := ss.RecvMsg(req); err != nil {
+			return err
+		}
+		return ss.SendMsg(req)
+	}, nil, grpc.WithChainStreamInterceptor(
+		interceptors.StreamClientInterceptorOfDeadline(interceptors.WithDefaultTimeout(time.Minute)),
+		// 记录 deadline interceptor 创建的 context
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+			streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			streamCtx = ctx
+			return streamer(ctx, desc, cc, method, opts...)
+		},
+	))
+
+	// client-streaming 收到响应时 RecvMsg 返回 nil，不会读取到 io.EOF
+	desc := &grpc.StreamDesc{StreamName: "Stream", ClientStreams: true}
+	stream, err := cc.NewStream(context.Background(), desc, streamMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&pb.Message{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&pb.Message{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// stream 结束后释放 deadline
+	select {
+	case <-streamCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("deadline context not released")
+	}
+}
@@ -0,0 +1,79 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+
+	apperrors "github.com/limingyao/excellent-go/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// statusError 业务错误转换为带 errdetails 的 status，原始错误只打印日志不返回给调用方
+func statusError(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var s *status.Status
+	var e *apperrors.Error
+	switch {
+	case errors.As(err, &e):
+		s = e.GRPCStatus()
+		if cause := e.Unwrap(); cause != nil {
+			log.WithField(CtxSessionIdKey, SessionIDFromContext(ctx)).WithField("method", method).
+				WithError(cause).Warn(e.Reason)
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		s = status.FromContextError(err)
+	default:
+		var ok bool
+		if s, ok = status.FromError(err); !ok {
+			s = status.New(codes.Unknown, err.Error())
+		}
+	}
+	return s.Err()
+}
+
+// sessionIdTrailer 错误响应通过 trailer 返回 session_id，gateway 错误信息中使用
+func sessionIdTrailer(ctx context.Context) metadata.MD {
+	if sessionId := SessionIDFromContext(ctx); len(sessionId) > 0 {
+		return metadata.Pairs(metadataSessionIdKey, sessionId)
+	}
+	return nil
+}
+
+// UnaryServerInterceptorOfError 将 errors.Error 转换为 status，需要在 OfContext 之后
+func UnaryServerInterceptorOfError() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		resp, err = handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		if md := sessionIdTrailer(ctx); md != nil {
+			_ = grpc.SetTrailer(ctx, md)
+		}
+		return resp, statusError(ctx, info.FullMethod, err)
+	}
+}
+
+// StreamServerInterceptorOfError 将 errors.Error 转换为 status，需要在 OfContext 之后
+func StreamServerInterceptorOfError() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err == nil {
+			return nil
+		}
+
+		if md := sessionIdTrailer(ss.Context()); md != nil {
+			ss.SetTrailer(md)
+		}
+		return statusError(ss.Context(), info.FullMethod, err)
+	}
+}
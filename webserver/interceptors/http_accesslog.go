@@ -0,0 +1,102 @@
+package interceptors
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const metadataRequestIdKey = "X-Request-Id"
+
+// httpClientIP 优先使用 X-Forwarded-For, X-Real-Ip，其次使用连接的对端地址
+func httpClientIP(r *http.Request) string {
+	if ips := r.Header.Get(metadataForwardedKey); len(ips) > 0 {
+		return strings.TrimSpace(strings.Split(ips, ",")[0])
+	}
+	if ip := r.Header.Get(metadataRealIpKey); len(ip) > 0 {
+		return strings.TrimSpace(ip)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// HttpMiddlewareOfSessionId 使用请求头 X-Session-Id 或 X-Request-Id 作为 session id，不存在时生成，
+// 写回请求头 X-Session-Id, X-Request-Id 由 gateway 转发给 grpc 服务，同时通过响应头返回，
+// X-Request-Id 不存在时与 session id 相同，http handler 可通过 SessionIDFromContext 获取
+func HttpMiddlewareOfSessionId() HttpMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := r.Header.Get(metadataRequestIdKey)
+			sessionId := r.Header.Get(metadataSessionIdKey)
+			if len(sessionId) < 1 {
+				sessionId = requestId
+			}
+			if len(sessionId) < 1 {
+				sessionId = uuid.New().String()
+			}
+			if len(requestId) < 1 {
+				requestId = sessionId
+			}
+			r.Header.Set(metadataSessionIdKey, sessionId)
+			r.Header.Set(metadataRequestIdKey, requestId)
+			w.Header().Set(metadataSessionIdKey, sessionId)
+			w.Header().Set(metadataRequestIdKey, requestId)
+
+			ctx := WithClientIP(WithSessionID(r.Context(), sessionId), httpClientIP(r))
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HttpMiddlewareOfAccessLog 每个 http 请求打印一行访问日志，支持 WithSampleRate, WithSlowThreshold,
+// session id 读取请求头 X-Session-Id，与 HttpMiddlewareOfSessionId 一起使用时放在其外层或内层均可
+func HttpMiddlewareOfAccessLog(opts ...AccessLogOption) HttpMiddleware {
+	o := newAccessLogOptions(opts...)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.level == AccessLogNone {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			mw := &statusResponseWriter{ResponseWriter: w}
+			handler.ServeHTTP(mw, r)
+			if mw.code == 0 {
+				mw.code = http.StatusOK
+			}
+
+			cost := time.Since(start)
+			slow := o.slowThreshold > 0 && cost >= o.slowThreshold
+			if mw.code < http.StatusInternalServerError && !slow && o.sampleRate < 1 && rand.Float64() >= o.sampleRate {
+				return
+			}
+
+			logger := log.WithFields(log.Fields{
+				CtxSessionIdKey: r.Header.Get(metadataSessionIdKey),
+				CtxClientKey:    httpClientIP(r),
+				"method":        r.Method,
+				"path":          r.URL.Path,
+				"status":        mw.code,
+				"bytes":         mw.size,
+				"cost":          cost,
+				"user_agent":    r.UserAgent(),
+			})
+			switch {
+			case slow:
+				logger.Warn("slow request")
+			case mw.code >= http.StatusInternalServerError:
+				logger.Error("access")
+			default:
+				logger.Info("access")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package interceptors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestHttpMiddlewareOfAccessLog(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	var sessionId string
+	handler := interceptors.ChainHttpMiddleware(
+		interceptors.HttpMiddlewareOfAccessLog(),
+		interceptors.HttpMiddlewareOfSessionId(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionId = interceptors.SessionIDFromContext(r.Context())
+		http.Error(w, "oops", http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", nil)
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if len(sessionId) < 1 || w.Header().Get("X-Session-Id") != sessionId {
+		t.Fatalf("unexpected session id %q, response %v", sessionId, w.Header())
+	}
+	// 生成的 id 同时通过 X-Request-Id 返回
+	if w.Header().Get("X-Request-Id") != sessionId {
+		t.Errorf("unexpected X-Request-Id, response %v", w.Header())
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.ErrorLevel {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+	want := log.Fields{
+		interceptors.CtxSessionIdKey: sessionId,
+		interceptors.CtxClientKey:    "10.0.0.1",
+		"method":                     http.MethodPost,
+		"path":                       "/echo",
+		"status":                     http.StatusInternalServerError,
+		"bytes":                      len("oops\n"),
+		"user_agent":                 "test",
+	}
+	for key, value := range want {
+		if entry.Data[key] != value {
+			t.Errorf("field %s: got %v, want %v", key, entry.Data[key], value)
+		}
+	}
+}
+
+func TestHttpMiddlewareOfSessionIdRequestId(t *testing.T) {
+	var sessionId string
+	handler := interceptors.HttpMiddlewareOfSessionId()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionId = interceptors.SessionIDFromContext(r.Context())
+	}))
+
+	for _, c := range []struct {
+		session, request string
+		wantSession      string
+	}{
+		{"", "request", "request"},
+		{"session", "request", "session"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if len(c.session) > 0 {
+			req.Header.Set("X-Session-Id", c.session)
+		}
+		req.Header.Set("X-Request-Id", c.request)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		// 使用 X-Request-Id 的客户端通过同名响应头获取
+		if sessionId != c.wantSession || w.Header().Get("X-Session-Id") != c.wantSession ||
+			w.Header().Get("X-Request-Id") != c.request {
+			t.Errorf("unexpected session id %q, response %v", sessionId, w.Header())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package interceptors_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echoService struct {
+	pb.UnimplementedEchoServiceServer
+	echo func(ctx context.Context, req *pb.Message) (*pb.Message, error)
+}
+
+func (s *echoService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	if s.echo != nil {
+		return s.echo(ctx, req)
+	}
+	if req.Value == "error" {
+		return nil, status.Errorf(codes.InvalidArgument, "[%s]", req.Value)
+	}
+	return &pb.Message{Value: fmt.Sprintf("[%s]", req.Value)}, nil
+}
+
+// newEchoClient start echo service on bufconn
+func newEchoClient(t *testing.T, svc *echoService, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) pb.EchoServiceClient {
+	return pb.NewEchoServiceClient(newConn(t, func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, svc)
+	}, serverOpts, dialOpts...))
+}
+
+// streamMethod 测试用的双向流方法，请求和响应都是 pb.Message
+const streamMethod = "/internal.proto.StreamService/Stream"
+
+var streamDesc = &grpc.StreamDesc{StreamName: "Stream", ServerStreams: true, ClientStreams: true}
+
+// newStreamConn start a bidi stream service on bufconn, handler 处理 streamMethod 的每个流
+func newStreamConn(
+	t *testing.T, handler grpc.StreamHandler, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption,
+) *grpc.ClientConn {
+	return newConn(t, func(srv *grpc.Server) {
+		srv.RegisterService(&grpc.ServiceDesc{
+			ServiceName: "internal.proto.StreamService",
+			HandlerType: (*interface{})(nil),
+			Streams: []grpc.StreamDesc{{
+				StreamName:    streamDesc.StreamName,
+				Handler:       handler,
+				ServerStreams: true,
+				ClientStreams: true,
+			}},
+		}, struct{}{})
+	}, serverOpts, dialOpts...)
+}
+
+func newConn(
+	t *testing.T, register func(srv *grpc.Server), serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption,
+) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(serverOpts...)
+	register(srv)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	dialOpts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, dialOpts...)
+	cc, err := grpc.Dial("passthrough:///bufconn", dialOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	return cc
+}
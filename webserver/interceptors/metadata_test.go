@@ -0,0 +1,76 @@
+package interceptors_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetadata(t *testing.T) {
+	// downstream 返回收到的 metadata
+	downstream := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			var values []string
+			for _, key := range []string{"X-User-Id", "X-Tenant-Id", "X-Caller", "X-Session-Id", "X-Secret"} {
+				values = append(values, key+"="+strings.Join(md.Get(key), ","))
+			}
+			return &pb.Message{Value: strings.Join(values, ";")}, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfMetadata(interceptors.WithPropagateKeys("X-User-Id", "X-Tenant-Id")),
+	))
+
+	// upstream 调用 downstream，调用方设置的 metadata 需要保留
+	upstream := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			ctx = interceptors.WithSessionID(ctx, "session")
+			ctx = metadata.AppendToOutgoingContext(ctx, "X-Caller", "upstream", "X-Tenant-Id", "override")
+			return downstream.Echo(ctx, req)
+		},
+	}, nil)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"X-User-Id", "user", "X-Tenant-Id", "tenant", "X-Secret", "secret")
+	resp, err := upstream.Echo(ctx, &pb.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "X-User-Id=user;X-Tenant-Id=override;X-Caller=upstream;X-Session-Id=session;X-Secret="
+	if resp.Value != expect {
+		t.Errorf("expect %s, got %s", expect, resp.Value)
+	}
+}
+
+func TestMetadataSessionId(t *testing.T) {
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return &pb.Message{Value: strings.Join(md.Get("X-Session-Id"), ",")}, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(interceptors.UnaryClientInterceptorOfMetadata()))
+
+	// context 中没有 session id 时保留调用方设置的 X-Session-Id
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "X-Session-Id", "caller")
+	resp, err := client.Echo(ctx, &pb.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Value != "caller" {
+		t.Errorf("expect caller, got %s", resp.Value)
+	}
+
+	// 都没有时生成
+	resp, err = client.Echo(context.Background(), &pb.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Value) < 1 || strings.Contains(resp.Value, ",") {
+		t.Errorf("unexpected session id %s", resp.Value)
+	}
+}
@@ -0,0 +1,333 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	metrics "github.com/limingyao/excellent-go/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type metricsOptions struct {
+	handlingBuckets []float64 // 耗时分布
+	sizeBuckets     []float64 // 消息大小分布
+}
+
+var (
+	defaultMetricsOptions = metricsOptions{
+		handlingBuckets: prometheus.DefBuckets,
+		sizeBuckets:     prometheus.ExponentialBuckets(64, 4, 10), // 64B ~ 16MB
+	}
+)
+
+type MetricsOption func(*metricsOptions)
+
+// WithHandlingBuckets 耗时分布的 buckets，单位秒，默认 prometheus.DefBuckets
+func WithHandlingBuckets(buckets ...float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.handlingBuckets = buckets
+	}
+}
+
+// WithSizeBuckets 消息大小分布的 buckets，单位字节
+func WithSizeBuckets(buckets ...float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.sizeBuckets = buckets
+	}
+}
+
+// histogramBuckets 已注册的 histogram 使用的 buckets
+var histogramBuckets sync.Map // name -> []float64
+
+// register 注册到 metrics/prometheus，已注册时返回已存在的 collector
+func register(c prometheus.Collector) prometheus.Collector {
+	if err := metrics.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// registerHistogram 已注册时复用已存在的 histogram，buckets 不同时打印 warn 日志
+func registerHistogram(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	h := register(prometheus.NewHistogramVec(opts, labels)).(*prometheus.HistogramVec)
+	if prev, loaded := histogramBuckets.LoadOrStore(opts.Name, opts.Buckets); loaded {
+		if buckets := prev.([]float64); !equalBuckets(buckets, opts.Buckets) {
+			log.Warnf("metric %s already registered with buckets %v, ignore buckets %v", opts.Name, buckets, opts.Buckets)
+		}
+	}
+	return h
+}
+
+func equalBuckets(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type rpcMetrics struct {
+	handled  *prometheus.CounterVec   // method, code
+	handling *prometheus.HistogramVec // method
+	inFlight *prometheus.GaugeVec     // method
+	received *prometheus.HistogramVec // method
+	sent     *prometheus.HistogramVec // method
+}
+
+// newRpcMetrics side: server, client
+func newRpcMetrics(side string, opts ...MetricsOption) *rpcMetrics {
+	o := defaultMetricsOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &rpcMetrics{
+		handled: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_" + side + "_handled_total",
+			Help: "Total number of RPCs completed, regardless of success or failure.",
+		}, []string{"method", "code"})).(*prometheus.CounterVec),
+		handling: registerHistogram(prometheus.HistogramOpts{
+			Name:    "grpc_" + side + "_handling_seconds",
+			Help:    "Histogram of RPC handling latency in seconds.",
+			Buckets: o.handlingBuckets,
+		}, []string{"method"}),
+		inFlight: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_" + side + "_in_flight",
+			Help: "Number of RPCs currently in flight.",
+		}, []string{"method"})).(*prometheus.GaugeVec),
+		received: registerHistogram(prometheus.HistogramOpts{
+			Name:    "grpc_" + side + "_msg_received_bytes",
+			Help:    "Histogram of received message sizes in bytes.",
+			Buckets: o.sizeBuckets,
+		}, []string{"method"}),
+		sent: registerHistogram(prometheus.HistogramOpts{
+			Name:    "grpc_" + side + "_msg_sent_bytes",
+			Help:    "Histogram of sent message sizes in bytes.",
+			Buckets: o.sizeBuckets,
+		}, []string{"method"}),
+	}
+}
+
+func (m *rpcMetrics) start(method string) time.Time {
+	m.inFlight.WithLabelValues(method).Inc()
+	return time.Now()
+}
+
+func (m *rpcMetrics) done(method string, start time.Time, err error) {
+	m.inFlight.WithLabelValues(method).Dec()
+	m.handled.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.handling.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (m *rpcMetrics) observeReceived(method string, msg interface{}) {
+	if msg, ok := msg.(proto.Message); ok && msg != nil {
+		m.received.WithLabelValues(method).Observe(float64(proto.Size(msg)))
+	}
+}
+
+func (m *rpcMetrics) observeSent(method string, msg interface{}) {
+	if msg, ok := msg.(proto.Message); ok && msg != nil {
+		m.sent.WithLabelValues(method).Observe(float64(proto.Size(msg)))
+	}
+}
+
+// UnaryServerInterceptorOfMetrics record grpc_server_* metrics
+func UnaryServerInterceptorOfMetrics(opts ...MetricsOption) grpc.UnaryServerInterceptor {
+	m := newRpcMetrics("server", opts...)
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		start := m.start(info.FullMethod)
+		m.observeReceived(info.FullMethod, req)
+
+		resp, err = handler(ctx, req)
+
+		if err == nil {
+			m.observeSent(info.FullMethod, resp)
+		}
+		m.done(info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+type metricsServerStream struct {
+	grpc.ServerStream
+	metrics *rpcMetrics
+	method  string
+}
+
+func (s *metricsServerStream) RecvMsg(msg interface{}) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		s.metrics.observeReceived(s.method, msg)
+	}
+	return err
+}
+
+func (s *metricsServerStream) SendMsg(msg interface{}) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		s.metrics.observeSent(s.method, msg)
+	}
+	return err
+}
+
+// StreamServerInterceptorOfMetrics record grpc_server_* metrics
+func StreamServerInterceptorOfMetrics(opts ...MetricsOption) grpc.StreamServerInterceptor {
+	m := newRpcMetrics("server", opts...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := m.start(info.FullMethod)
+
+		err := handler(srv, &metricsServerStream{ServerStream: ss, metrics: m, method: info.FullMethod})
+
+		m.done(info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+// UnaryClientInterceptorOfMetrics record grpc_client_* metrics
+func UnaryClientInterceptorOfMetrics(opts ...MetricsOption) grpc.UnaryClientInterceptor {
+	m := newRpcMetrics("client", opts...)
+	return func(ctx context.Context, method string, req, resp interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := m.start(method)
+		m.observeSent(method, req)
+
+		err := invoker(ctx, method, req, resp, cc, opts...)
+
+		if err == nil {
+			m.observeReceived(method, resp)
+		}
+		m.done(method, start, err)
+
+		return err
+	}
+}
+
+type metricsClientStream struct {
+	grpc.ClientStream
+	metrics *rpcMetrics
+	method  string
+}
+
+func (s *metricsClientStream) SendMsg(msg interface{}) error {
+	err := s.ClientStream.SendMsg(msg)
+	if err == nil {
+		s.metrics.observeSent(s.method, msg)
+	}
+	return err
+}
+
+func (s *metricsClientStream) RecvMsg(msg interface{}) error {
+	err := s.ClientStream.RecvMsg(msg)
+	if err == nil {
+		s.metrics.observeReceived(s.method, msg)
+	}
+	return err
+}
+
+// StreamClientInterceptorOfMetrics record grpc_client_* metrics when the stream finished,
+// including received io.EOF, error and ctx canceled
+func StreamClientInterceptorOfMetrics(opts ...MetricsOption) grpc.StreamClientInterceptor {
+	m := newRpcMetrics("client", opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := m.start(method)
+		var once sync.Once
+		done := func(err error) {
+			once.Do(func() {
+				m.done(method, start, err)
+			})
+		}
+
+		// grpc 在流结束或 ctx 结束时调用 OnFinish
+		stream, err := streamer(ctx, desc, cc, method, append(opts, grpc.OnFinish(done))...)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		return &metricsClientStream{ClientStream: stream, metrics: m, method: method}, nil
+	}
+}
+
+type httpMetrics struct {
+	handled  *prometheus.CounterVec   // route, method, code
+	handling *prometheus.HistogramVec // route, method
+	inFlight *prometheus.GaugeVec     // route
+	request  *prometheus.HistogramVec // route
+	response *prometheus.HistogramVec // route
+}
+
+func newHttpMetrics(opts ...MetricsOption) *httpMetrics {
+	o := defaultMetricsOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &httpMetrics{
+		handled: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_server_handled_total",
+			Help: "Total number of HTTP requests completed.",
+		}, []string{"route", "method", "code"})).(*prometheus.CounterVec),
+		handling: registerHistogram(prometheus.HistogramOpts{
+			Name:    "http_server_handling_seconds",
+			Help:    "Histogram of HTTP request handling latency in seconds.",
+			Buckets: o.handlingBuckets,
+		}, []string{"route", "method"}),
+		inFlight: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_server_in_flight",
+			Help: "Number of HTTP requests currently in flight.",
+		}, []string{"route"})).(*prometheus.GaugeVec),
+		request: registerHistogram(prometheus.HistogramOpts{
+			Name:    "http_server_request_bytes",
+			Help:    "Histogram of HTTP request body sizes in bytes.",
+			Buckets: o.sizeBuckets,
+		}, []string{"route"}),
+		response: registerHistogram(prometheus.HistogramOpts{
+			Name:    "http_server_response_bytes",
+			Help:    "Histogram of HTTP response body sizes in bytes.",
+			Buckets: o.sizeBuckets,
+		}, []string{"route"}),
+	}
+}
+
+// HttpHandlerOfMetrics record http_server_* metrics, route is the registered pattern rather than the request path
+func HttpHandlerOfMetrics(route string, handler http.Handler, opts ...MetricsOption) http.Handler {
+	m := newHttpMetrics(opts...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.WithLabelValues(route).Inc()
+		defer m.inFlight.WithLabelValues(route).Dec()
+		if r.ContentLength > 0 {
+			m.request.WithLabelValues(route).Observe(float64(r.ContentLength))
+		}
+
+		start := time.Now()
+		mw := &statusResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(mw, r)
+		if mw.code == 0 {
+			mw.code = http.StatusOK
+		}
+
+		m.handled.WithLabelValues(route, r.Method, strconv.Itoa(mw.code)).Inc()
+		m.handling.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		m.response.WithLabelValues(route).Observe(float64(mw.size))
+	})
+}
@@ -0,0 +1,139 @@
+package interceptors_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	metrics "github.com/limingyao/excellent-go/metrics/prometheus"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+// scrapeMetrics 返回所有指标的当前值，key 为 name{labels}
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	rec := httptest.NewRecorder()
+	metrics.Handler(
+		metrics.WithDisableProcessCollector(),
+		metrics.WithDisableProcessExtCollector(),
+	).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[line[:i]] = v
+	}
+	return values
+}
+
+// 全局 registry 在多次运行之间共享，按增量比较
+func TestMetrics(t *testing.T) {
+	before := scrapeMetrics(t)
+
+	client := newEchoClient(t, &echoService{},
+		[]grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfMetrics())},
+		grpc.WithChainUnaryInterceptor(interceptors.UnaryClientInterceptorOfMetrics()),
+	)
+	for _, value := range []string{"a", "b", "error"} {
+		_, _ = client.Echo(context.Background(), &pb.Message{Value: value})
+	}
+
+	handler := interceptors.HttpHandlerOfMetrics("/hello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello", nil))
+
+	after := scrapeMetrics(t)
+	for series, delta := range map[string]float64{
+		`grpc_server_handled_total{code="OK",method="/internal.proto.EchoService/Echo"}`:              2,
+		`grpc_server_handled_total{code="InvalidArgument",method="/internal.proto.EchoService/Echo"}`: 1,
+		`grpc_client_handled_total{code="OK",method="/internal.proto.EchoService/Echo"}`:              2,
+		`grpc_server_handling_seconds_count{method="/internal.proto.EchoService/Echo"}`:               3,
+		`grpc_server_msg_received_bytes_count{method="/internal.proto.EchoService/Echo"}`:             3,
+		`http_server_handled_total{code="202",method="GET",route="/hello"}`:                           1,
+		`http_server_response_bytes_sum{route="/hello"}`:                                              5,
+	} {
+		if got := after[series] - before[series]; got != delta {
+			t.Errorf("%s: expect +%v, got +%v", series, delta, got)
+		}
+	}
+	if v, ok := after[`grpc_server_in_flight{method="/internal.proto.EchoService/Echo"}`]; !ok || v != 0 {
+		t.Errorf("unexpected grpc_server_in_flight %v %v", v, ok)
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	// 重复创建复用已注册的指标，buckets 相同时不打印日志
+	interceptors.UnaryServerInterceptorOfMetrics()
+	interceptors.UnaryServerInterceptorOfMetrics()
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("unexpected entries %v", hook.AllEntries())
+	}
+
+	interceptors.UnaryServerInterceptorOfMetrics(interceptors.WithHandlingBuckets(0.1, 1))
+	entry := hook.LastEntry()
+	if entry == nil || !strings.Contains(entry.Message, "grpc_server_handling_seconds") {
+		t.Errorf("expect buckets warning, got %v", entry)
+	}
+}
+
+func TestStreamClientMetrics(t *testing.T) {
+	cc := newStreamConn(t, func(_ interface{}, ss grpc.ServerStream) error {
+		// 等待客户端取消
+		<-ss.Context().Done()
+		return nil
+	}, nil, grpc.WithChainStreamInterceptor(interceptors.StreamClientInterceptorOfMetrics()))
+
+	before := scrapeMetrics(t)
+	inFlight := `grpc_client_in_flight{method="` + streamMethod + `"}`
+
+	// 不读取到 io.EOF，直接取消
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(ctx, streamDesc, streamMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&pb.Message{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := scrapeMetrics(t)[inFlight]; v != 1 {
+		t.Fatalf("expect 1 in flight, got %v", v)
+	}
+	cancel()
+
+	series := `grpc_client_handled_total{code="Canceled",method="` + streamMethod + `"}`
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		after := scrapeMetrics(t)
+		if after[inFlight] == 0 && after[series]-before[series] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream not finished, in flight %v, handled %v", after[inFlight], after[series])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
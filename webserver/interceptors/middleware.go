@@ -0,0 +1,76 @@
+package interceptors
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HttpMiddleware http 中间件，用于 gateway 和 RegisterHttpHandler 注册的路由
+type HttpMiddleware func(http.Handler) http.Handler
+
+// ChainHttpMiddleware 组合多个中间件，第一个在最外层
+func ChainHttpMiddleware(middlewares ...HttpMiddleware) HttpMiddleware {
+	return func(handler http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
+// HttpMiddlewareOfBodyLimit 限制请求 body 大小，Content-Length 超出时直接返回 413，否则读取超出时返回错误
+func HttpMiddlewareOfBodyLimit(limit int64) HttpMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, "request body too large, limit "+strconv.FormatInt(limit, 10),
+					http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+type securityHeaderOptions struct {
+	headers map[string]string
+}
+
+type SecurityHeaderOption func(*securityHeaderOptions)
+
+// WithSecurityHeader 设置或覆盖响应头，value 为空时不设置该响应头
+func WithSecurityHeader(key, value string) SecurityHeaderOption {
+	return func(o *securityHeaderOptions) {
+		o.headers[http.CanonicalHeaderKey(key)] = value
+	}
+}
+
+// HttpMiddlewareOfSecurityHeaders 设置常用的安全响应头，handler 可以覆盖，
+// Strict-Transport-Security 仅在 TLS 连接上设置
+func HttpMiddlewareOfSecurityHeaders(opts ...SecurityHeaderOption) HttpMiddleware {
+	o := securityHeaderOptions{headers: map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for key, value := range o.headers {
+				if len(value) < 1 || (key == "Strict-Transport-Security" && r.TLS == nil) {
+					continue
+				}
+				h.Set(key, value)
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
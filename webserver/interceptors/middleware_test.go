@@ -0,0 +1,191 @@
+package interceptors_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+)
+
+func TestChainHttpMiddleware(t *testing.T) {
+	var order []string
+	middleware := func(name string) interceptors.HttpMiddleware {
+		return func(handler http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				handler.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := interceptors.ChainHttpMiddleware(middleware("a"), middleware("b"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "handler")
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if strings.Join(order, ",") != "a,b,handler" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestHttpMiddlewareOfCORS(t *testing.T) {
+	called := false
+	handler := interceptors.HttpMiddlewareOfCORS(
+		interceptors.WithAllowedOrigins("https://*.example.com"),
+		interceptors.WithExposedHeaders("X-Session-Id"),
+		interceptors.WithAllowCredentials(),
+		interceptors.WithMaxAge(time.Hour),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	// preflight
+	req := httptest.NewRequest(http.MethodOptions, "/echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-session-id")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if called || w.Code != http.StatusNoContent ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != http.MethodPost ||
+		w.Header().Get("Access-Control-Allow-Headers") != "content-type, x-session-id" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("unexpected preflight response %d %v", w.Code, w.Header())
+	}
+
+	// preflight with not allowed header
+	req.Header.Set("Access-Control-Request-Headers", "x-custom")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("unexpected preflight response %v", w.Header())
+	}
+
+	// actual request
+	req = httptest.NewRequest(http.MethodPost, "/echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "X-Session-Id" {
+		t.Errorf("unexpected response %v", w.Header())
+	}
+
+	// not allowed origin
+	req.Header.Set("Origin", "https://example.org")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("unexpected response %v", w.Header())
+	}
+}
+
+func TestHttpMiddlewareOfCompress(t *testing.T) {
+	body := strings.Repeat("excellent-go ", 100)
+	handler := interceptors.HttpMiddlewareOfCompress(interceptors.WithCompressMinSize(512))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			if r.URL.Query().Get("small") != "" {
+				_, _ = io.WriteString(w, "small")
+				return
+			}
+			_, _ = io.WriteString(w, body)
+		}))
+
+	tests := []struct {
+		name           string
+		url            string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"br", "/", "gzip, deflate, br", interceptors.EncodingBrotli},
+		{"gzip", "/", "gzip, br;q=0", interceptors.EncodingGzip},
+		{"identity", "/", "", ""},
+		{"small", "/?small=1", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("got encoding %q, want %q", got, tt.wantEncoding)
+			}
+			var r io.Reader = w.Body
+			switch tt.wantEncoding {
+			case interceptors.EncodingGzip:
+				gr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = gr
+			case interceptors.EncodingBrotli:
+				r = brotli.NewReader(w.Body)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := body
+			if tt.name == "small" {
+				want = "small"
+			}
+			if string(got) != want {
+				t.Errorf("unexpected body %q", got)
+			}
+		})
+	}
+}
+
+func TestHttpMiddlewareOfBodyLimit(t *testing.T) {
+	handler := interceptors.HttpMiddlewareOfBodyLimit(8)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	for body, want := range map[string]int{"small": http.StatusOK, "too large body": http.StatusRequestEntityTooLarge} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("body %q: got %d, want %d", body, w.Code, want)
+		}
+	}
+
+	// unknown content length
+	req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("too large body")))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHttpMiddlewareOfSecurityHeaders(t *testing.T) {
+	handler := interceptors.HttpMiddlewareOfSecurityHeaders(
+		interceptors.WithSecurityHeader("X-Frame-Options", "SAMEORIGIN"),
+		interceptors.WithSecurityHeader("Content-Security-Policy", "default-src 'self'"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	h := w.Header()
+	if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("X-Frame-Options") != "SAMEORIGIN" ||
+		h.Get("Content-Security-Policy") != "default-src 'self'" || len(h.Get("Strict-Transport-Security")) > 0 {
+		t.Errorf("unexpected headers %v", h)
+	}
+}
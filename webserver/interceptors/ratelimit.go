@@ -0,0 +1,295 @@
+package interceptors
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metadataRetryAfterKey = "retry-after" // 单位秒，向上取整
+
+	limiterGlobal      = "global"
+	limiterMethod      = "method"
+	limiterClient      = "client"
+	limiterConcurrency = "concurrency"
+)
+
+type limit struct {
+	limit rate.Limit
+	burst int
+}
+
+type rateLimitOptions struct {
+	global        *limit           // 全局限流
+	methods       map[string]limit // 按方法限流，key 为 full method: /package.Service/Method
+	client        *limit           // 按客户端限流
+	clientKey     string           // 客户端标识的 metadata key，为空时使用 ClientIPFromContext
+	clientIdleTTL time.Duration    // 客户端限流器空闲回收时间
+	maxClients    int              // 客户端限流器数量上限，超过时回收最久未使用的
+}
+
+type RateLimitOption func(*rateLimitOptions)
+
+// WithGlobalLimit 全局限流，每秒 r 个请求，突发 burst
+func WithGlobalLimit(r float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.global = &limit{limit: rate.Limit(r), burst: burst}
+	}
+}
+
+// WithMethodLimit 按方法限流，fullMethod 如 /package.Service/Method
+func WithMethodLimit(fullMethod string, r float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.methods[fullMethod] = limit{limit: rate.Limit(r), burst: burst}
+	}
+}
+
+// WithClientLimit 按客户端限流，客户端标识默认取 ClientIPFromContext，
+// 需要在 OfContext 之后，否则 gateway 请求都使用回环地址作为客户端标识
+func WithClientLimit(r float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.client = &limit{limit: rate.Limit(r), burst: burst}
+	}
+}
+
+// WithClientMetadataKey 从 metadata 读取客户端标识，如 X-App-Id
+func WithClientMetadataKey(key string) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.clientKey = key
+	}
+}
+
+// WithClientIdleTTL 客户端限流器空闲超过 ttl 后回收，默认 10 分钟
+func WithClientIdleTTL(ttl time.Duration) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.clientIdleTTL = ttl
+	}
+}
+
+// WithMaxClients 客户端限流器数量上限，超过时回收最久未使用的，默认 10000
+func WithMaxClients(max int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.maxClients = max
+	}
+}
+
+// rejectedCounter grpc_server_rejected_total{method, limiter}
+func rejectedCounter() *prometheus.CounterVec {
+	return register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_rejected_total",
+		Help: "Total number of RPCs rejected by rate or concurrency limiters.",
+	}, []string{"method", "limiter"})).(*prometheus.CounterVec)
+}
+
+type clientLimiter struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	opts     rateLimitOptions
+	global   *rate.Limiter
+	methods  map[string]*rate.Limiter
+	rejected *prometheus.CounterVec
+
+	mu      sync.Mutex
+	clients map[string]*list.Element // value 为 *clientLimiter
+	lru     *list.List               // 最近使用的在前
+}
+
+func newRateLimiter(opts ...RateLimitOption) *rateLimiter {
+	o := rateLimitOptions{
+		methods:       make(map[string]limit),
+		clientIdleTTL: 10 * time.Minute,
+		maxClients:    10000,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	l := &rateLimiter{
+		opts:     o,
+		methods:  make(map[string]*rate.Limiter, len(o.methods)),
+		rejected: rejectedCounter(),
+		clients:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if o.global != nil {
+		l.global = rate.NewLimiter(o.global.limit, o.global.burst)
+	}
+	for method, lim := range o.methods {
+		l.methods[method] = rate.NewLimiter(lim.limit, lim.burst)
+	}
+	return l
+}
+
+// clientIdentity 优先读取 metadata，否则使用 ClientIPFromContext
+func (l *rateLimiter) clientIdentity(ctx context.Context) string {
+	if len(l.opts.clientKey) > 0 {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(l.opts.clientKey); len(values) > 0 && len(values[0]) > 0 {
+			return values[0]
+		}
+	}
+	return ClientIPFromContext(ctx)
+}
+
+func (l *rateLimiter) clientLimiter(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 回收空闲的客户端限流器
+	for e := l.lru.Back(); e != nil && now.Sub(e.Value.(*clientLimiter).lastSeen) > l.opts.clientIdleTTL; e = l.lru.Back() {
+		l.remove(e)
+	}
+
+	if e, ok := l.clients[client]; ok {
+		c := e.Value.(*clientLimiter)
+		c.lastSeen = now
+		l.lru.MoveToFront(e)
+		return c.limiter
+	}
+
+	// 客户端标识可由调用方控制，限制数量避免无限增长
+	for l.opts.maxClients > 0 && l.lru.Len() >= l.opts.maxClients {
+		l.remove(l.lru.Back())
+	}
+	c := &clientLimiter{
+		key:      client,
+		limiter:  rate.NewLimiter(l.opts.client.limit, l.opts.client.burst),
+		lastSeen: now,
+	}
+	l.clients[client] = l.lru.PushFront(c)
+	return c.limiter
+}
+
+func (l *rateLimiter) remove(e *list.Element) {
+	delete(l.clients, e.Value.(*clientLimiter).key)
+	l.lru.Remove(e)
+}
+
+// allow 所有限流器都有令牌时放行，否则归还已占用的令牌，返回需要等待的时间
+func (l *rateLimiter) allow(ctx context.Context, method string) (string, time.Duration, bool) {
+	now := time.Now()
+
+	type named struct {
+		name    string
+		limiter *rate.Limiter
+	}
+	limiters := make([]named, 0, 3)
+	if l.global != nil {
+		limiters = append(limiters, named{limiterGlobal, l.global})
+	}
+	if limiter, ok := l.methods[method]; ok {
+		limiters = append(limiters, named{limiterMethod, limiter})
+	}
+	if l.opts.client != nil {
+		if client := l.clientIdentity(ctx); len(client) > 0 {
+			limiters = append(limiters, named{limiterClient, l.clientLimiter(client, now)})
+		}
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	for _, n := range limiters {
+		r := n.limiter.ReserveN(now, 1)
+		if !r.OK() {
+			cancel()
+			return n.name, time.Second, false
+		}
+		reservations = append(reservations, r)
+		if delay := r.DelayFrom(now); delay > 0 {
+			cancel()
+			return n.name, delay, false
+		}
+	}
+	return "", 0, true
+}
+
+// resourceExhausted retry-after 写入 header metadata
+func resourceExhausted(setHeader func(metadata.MD) error, limiter string, retryAfter time.Duration) error {
+	if retryAfter > 0 {
+		seconds := int64(math.Ceil(retryAfter.Seconds()))
+		_ = setHeader(metadata.Pairs(metadataRetryAfterKey, strconv.FormatInt(seconds, 10)))
+	}
+	return status.Errorf(codes.ResourceExhausted, "%s limit exceeded", limiter)
+}
+
+// UnaryServerInterceptorOfRateLimit token bucket 限流，超限返回 ResourceExhausted 和 retry-after
+func UnaryServerInterceptorOfRateLimit(opts ...RateLimitOption) grpc.UnaryServerInterceptor {
+	l := newRateLimiter(opts...)
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		if limiter, retryAfter, ok := l.allow(ctx, info.FullMethod); !ok {
+			l.rejected.WithLabelValues(info.FullMethod, limiter).Inc()
+			return nil, resourceExhausted(func(md metadata.MD) error {
+				return grpc.SetHeader(ctx, md)
+			}, limiter, retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptorOfRateLimit token bucket 限流，每个 stream 占用一个令牌
+func StreamServerInterceptorOfRateLimit(opts ...RateLimitOption) grpc.StreamServerInterceptor {
+	l := newRateLimiter(opts...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limiter, retryAfter, ok := l.allow(ss.Context(), info.FullMethod); !ok {
+			l.rejected.WithLabelValues(info.FullMethod, limiter).Inc()
+			return resourceExhausted(ss.SetHeader, limiter, retryAfter)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// UnaryServerInterceptorOfConcurrencyLimit 限制同时处理的请求数，超限返回 ResourceExhausted
+func UnaryServerInterceptorOfConcurrencyLimit(max int64) grpc.UnaryServerInterceptor {
+	rejected := rejectedCounter()
+	var inFlight atomic.Int64
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		if inFlight.Inc() > max {
+			inFlight.Dec()
+			rejected.WithLabelValues(info.FullMethod, limiterConcurrency).Inc()
+			return nil, resourceExhausted(func(md metadata.MD) error {
+				return grpc.SetHeader(ctx, md)
+			}, limiterConcurrency, time.Second)
+		}
+		defer inFlight.Dec()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptorOfConcurrencyLimit 限制同时处理的 stream 数，超限返回 ResourceExhausted
+func StreamServerInterceptorOfConcurrencyLimit(max int64) grpc.StreamServerInterceptor {
+	rejected := rejectedCounter()
+	var inFlight atomic.Int64
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if inFlight.Inc() > max {
+			inFlight.Dec()
+			rejected.WithLabelValues(info.FullMethod, limiterConcurrency).Inc()
+			return resourceExhausted(ss.SetHeader, limiterConcurrency, time.Second)
+		}
+		defer inFlight.Dec()
+		return handler(srv, ss)
+	}
+}
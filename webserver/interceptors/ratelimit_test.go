@@ -0,0 +1,110 @@
+package interceptors_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimit(t *testing.T) {
+	client := newEchoClient(t, &echoService{},
+		[]grpc.ServerOption{grpc.ChainUnaryInterceptor(
+			interceptors.UnaryServerInterceptorOfRateLimit(
+				interceptors.WithGlobalLimit(1000, 1000),
+				interceptors.WithClientLimit(0.1, 1),
+				interceptors.WithClientMetadataKey("X-App-Id"),
+			),
+		)},
+	)
+
+	call := func(app string) (metadata.MD, error) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "X-App-Id", app)
+		_, err := client.Echo(ctx, &pb.Message{Value: "a"}, grpc.Header(&header))
+		return header, err
+	}
+
+	if _, err := call("a"); err != nil {
+		t.Fatal(err)
+	}
+	header, err := call("a")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expect ResourceExhausted, got %v", err)
+	}
+	if retryAfter := header.Get("retry-after"); len(retryAfter) != 1 || retryAfter[0] == "0" {
+		t.Errorf("unexpected retry-after %v", retryAfter)
+	}
+	// 不同客户端独立限流
+	if _, err := call("b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			entered <- struct{}{}
+			<-release
+			return req, nil
+		},
+	}, []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfConcurrencyLimit(1))})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := client.Echo(context.Background(), &pb.Message{Value: "a"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-entered
+
+	if _, err := client.Echo(context.Background(), &pb.Message{Value: "b"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expect ResourceExhausted, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestRateLimitMaxClients(t *testing.T) {
+	client := newEchoClient(t, &echoService{},
+		[]grpc.ServerOption{grpc.ChainUnaryInterceptor(
+			interceptors.UnaryServerInterceptorOfRateLimit(
+				interceptors.WithClientLimit(0.1, 1),
+				interceptors.WithClientMetadataKey("X-App-Id"),
+				interceptors.WithMaxClients(2),
+			),
+		)},
+	)
+
+	call := func(app string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "X-App-Id", app)
+		_, err := client.Echo(ctx, &pb.Message{Value: "a"})
+		return err
+	}
+
+	for _, app := range []string{"a", "b", "c"} {
+		if err := call(app); err != nil {
+			t.Fatalf("%s: %v", app, err)
+		}
+	}
+	// 超过上限时回收最久未使用的 a，重新创建限流器
+	if err := call("a"); err != nil {
+		t.Errorf("expect evicted client allowed, got %v", err)
+	}
+	if err := call("a"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expect ResourceExhausted, got %v", err)
+	}
+	// c 最近使用过，仍然保留
+	if err := call("c"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expect ResourceExhausted, got %v", err)
+	}
+}
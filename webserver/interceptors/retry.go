@@ -0,0 +1,243 @@
+package interceptors
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const metadataAttemptKey = "X-Retry-Attempt" // 从 1 开始
+
+type retryOptions struct {
+	codes       map[codes.Code]bool // 可重试的错误码
+	maxAttempts int                 // 最大尝试次数，包含第一次
+	baseBackoff time.Duration       // 第一次重试的等待时间，之后指数增长
+	maxBackoff  time.Duration       // 最大等待时间
+	jitter      float64             // 等待时间的随机浮动比例
+	hedgeDelay  time.Duration       // 对冲请求的间隔
+	hedgeMethod map[string]bool     // 允许对冲的幂等方法，规则同 WithPublicMethods
+}
+
+type RetryOption func(*retryOptions)
+
+// WithRetryCodes 可重试的错误码，默认 Unavailable
+func WithRetryCodes(retryCodes ...codes.Code) RetryOption {
+	return func(o *retryOptions) {
+		o.codes = make(map[codes.Code]bool, len(retryCodes))
+		for _, code := range retryCodes {
+			o.codes[code] = true
+		}
+	}
+}
+
+// WithMaxAttempts 最大尝试次数，包含第一次，默认 3，同时受 deadline 限制
+func WithMaxAttempts(attempts int) RetryOption {
+	return func(o *retryOptions) {
+		o.maxAttempts = attempts
+	}
+}
+
+// WithBackoff 指数退避，默认 base 50ms, max 1s
+func WithBackoff(base, max time.Duration) RetryOption {
+	return func(o *retryOptions) {
+		o.baseBackoff = base
+		o.maxBackoff = max
+	}
+}
+
+// WithBackoffJitter 等待时间随机浮动 ±jitter，默认 0.2
+func WithBackoffJitter(jitter float64) RetryOption {
+	return func(o *retryOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithHedging 对冲请求，上一次请求 delay 内未返回时并发发起下一次，delay 小于等于 0 时同时发起所有请求，只用于幂等方法
+func WithHedging(delay time.Duration, methods ...string) RetryOption {
+	return func(o *retryOptions) {
+		o.hedgeDelay = delay
+		for _, method := range methods {
+			o.hedgeMethod[method] = true
+		}
+	}
+}
+
+func newRetryOptions(opts ...RetryOption) retryOptions {
+	o := retryOptions{
+		codes:       map[codes.Code]bool{codes.Unavailable: true},
+		maxAttempts: 3,
+		baseBackoff: 50 * time.Millisecond,
+		maxBackoff:  time.Second,
+		jitter:      0.2,
+		hedgeMethod: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o retryOptions) retryable(err error) bool {
+	return o.codes[status.Code(err)]
+}
+
+func (o retryOptions) hedging(method string) bool {
+	for pattern := range o.hedgeMethod {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 第 retry 次重试的等待时间
+func (o retryOptions) backoff(retry int) time.Duration {
+	backoff := o.baseBackoff
+	for i := 1; i < retry && backoff < o.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.maxBackoff {
+		backoff = o.maxBackoff
+	}
+	if o.jitter > 0 {
+		backoff += time.Duration(float64(backoff) * o.jitter * (rand.Float64()*2 - 1))
+	}
+	return backoff
+}
+
+// wait 等待 backoff，deadline 之前来不及重试时返回 false
+func (o retryOptions) wait(ctx context.Context, retry int) bool {
+	backoff := o.backoff(retry)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+		return false
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type attemptKey struct{}
+
+// withAttempt 尝试次数写入 context 和 outgoing metadata
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	ctx = context.WithValue(ctx, attemptKey{}, attempt)
+	return metadata.AppendToOutgoingContext(ctx, metadataAttemptKey, strconv.Itoa(attempt))
+}
+
+// attemptFromContext 当前尝试次数，没有经过 OfRetry 时返回 0
+func attemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// UnaryClientInterceptorOfRetry 重试可重试的错误码，需要在 OfDebug, OfMetrics 之前
+func UnaryClientInterceptorOfRetry(opts ...RetryOption) grpc.UnaryClientInterceptor {
+	o := newRetryOptions(opts...)
+	return func(ctx context.Context, method string, req, resp interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if o.hedging(method) {
+			return o.hedge(ctx, method, req, resp, cc, invoker, opts...)
+		}
+
+		var err error
+		for attempt := 1; attempt <= o.maxAttempts; attempt++ {
+			if attempt > 1 && !o.wait(ctx, attempt-1) {
+				break
+			}
+			err = invoker(withAttempt(ctx, attempt), method, req, resp, cc, opts...)
+			if err == nil || !o.retryable(err) {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+type hedgeResult struct {
+	resp proto.Message
+	err  error
+}
+
+// hedge 每隔 hedgeDelay 发起一次请求，hedgeDelay 小于等于 0 时同时发起，第一个成功或不可重试的结果返回，其余请求取消，
+// 所有请求都失败时按 backoff 等待后再发起，每次请求使用 req 的副本，避免之后的拦截器并发修改
+func (o retryOptions) hedge(ctx context.Context, method string, req, resp interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, o.maxAttempts)
+	attempts := 0
+	launch := func() {
+		attempts++
+		// 并发请求不能共用 resp
+		r := proto.MessageV1(proto.MessageReflect(resp.(proto.Message)).New().Interface())
+		q := req
+		if m, ok := req.(proto.Message); ok {
+			q = proto.Clone(m)
+		}
+		go func(ctx context.Context) {
+			err := invoker(ctx, method, q, r, cc, opts...)
+			results <- hedgeResult{resp: r, err: err}
+		}(withAttempt(ctx, attempts))
+	}
+
+	launch()
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if o.hedgeDelay > 0 {
+		ticker = time.NewTicker(o.hedgeDelay)
+		defer ticker.Stop()
+		tick = ticker.C
+	} else {
+		for attempts < o.maxAttempts {
+			launch()
+		}
+	}
+
+	var err error
+	for pending := attempts; pending > 0; {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				resp.(proto.Message).Reset()
+				proto.Merge(resp.(proto.Message), result.resp)
+				return nil
+			}
+			if err = result.err; !o.retryable(err) {
+				return err
+			}
+			if pending == 0 && attempts < o.maxAttempts {
+				if !o.wait(ctx, attempts) {
+					return err
+				}
+				if ticker != nil {
+					ticker.Reset(o.hedgeDelay)
+				}
+				launch()
+				pending++
+			}
+		case <-tick:
+			if attempts < o.maxAttempts {
+				launch()
+				pending++
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
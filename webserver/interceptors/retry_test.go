@@ -0,0 +1,157 @@
+package interceptors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			calls.Inc()
+			md, _ := metadata.FromIncomingContext(ctx)
+			attempt := md.Get("X-Retry-Attempt")[0]
+			if req.Value == "invalid" {
+				return nil, status.Error(codes.InvalidArgument, attempt)
+			}
+			if attempt != req.Value {
+				return nil, status.Error(codes.Unavailable, attempt)
+			}
+			return &pb.Message{Value: attempt}, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfRetry(interceptors.WithBackoff(time.Millisecond, 10*time.Millisecond)),
+		interceptors.UnaryClientInterceptorOfDebug(),
+	))
+
+	for _, c := range []struct {
+		value string
+		code  codes.Code
+		calls int32
+	}{
+		{"1", codes.OK, 1},
+		{"3", codes.OK, 3},
+		{"4", codes.Unavailable, 3},
+		{"invalid", codes.InvalidArgument, 1},
+	} {
+		calls.Store(0)
+		resp, err := client.Echo(context.Background(), &pb.Message{Value: c.value})
+		if status.Code(err) != c.code || calls.Load() != c.calls {
+			t.Errorf("%s: expect %s with %d calls, got %v with %d calls", c.value, c.code, c.calls, err, calls.Load())
+		}
+		if err == nil && resp.Value != c.value {
+			t.Errorf("%s: unexpected response %s", c.value, resp.Value)
+		}
+	}
+}
+
+func TestHedging(t *testing.T) {
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			attempt := md.Get("X-Retry-Attempt")[0]
+			// 第一次请求阻塞，由对冲请求返回
+			if attempt == "1" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &pb.Message{Value: attempt}, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfRetry(interceptors.WithHedging(20*time.Millisecond, "/internal.proto.EchoService/")),
+	))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.Echo(ctx, &pb.Message{Value: "a"})
+	if err != nil || resp.Value != "2" {
+		t.Errorf("expect response from attempt 2, got %v %v", resp, err)
+	}
+}
+
+func TestHedgingWithoutDelay(t *testing.T) {
+	var calls atomic.Int32
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			calls.Inc()
+			md, _ := metadata.FromIncomingContext(ctx)
+			attempt := md.Get("X-Retry-Attempt")[0]
+			// 只有最后一次请求返回，其余请求阻塞
+			if attempt != "3" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &pb.Message{Value: attempt}, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfRetry(interceptors.WithHedging(0, "/internal.proto.EchoService/")),
+	))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.Echo(ctx, &pb.Message{Value: "a"})
+	if err != nil || resp.Value != "3" {
+		t.Errorf("expect response from attempt 3, got %v %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expect 3 calls, got %d", calls.Load())
+	}
+}
+
+func TestHedgingCopyRequest(t *testing.T) {
+	client := newEchoClient(t, &echoService{}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfRetry(interceptors.WithHedging(0, "/internal.proto.EchoService/")),
+		// 之后的拦截器修改请求，每次请求使用独立的副本
+		func(ctx context.Context, method string, req, resp interface{},
+			cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			req.(*pb.Message).Value = md.Get("X-Retry-Attempt")[0]
+			return invoker(ctx, method, req, resp, cc, opts...)
+		},
+	))
+
+	req := &pb.Message{Value: "a"}
+	if _, err := client.Echo(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Value != "a" {
+		t.Errorf("request modified to %s", req.Value)
+	}
+}
+
+func TestHedgingBackoff(t *testing.T) {
+	client := newEchoClient(t, &echoService{
+		echo: func(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if attempt := md.Get("X-Retry-Attempt")[0]; attempt == "1" {
+				return nil, status.Error(codes.Unavailable, attempt)
+			}
+			return req, nil
+		},
+	}, nil, grpc.WithChainUnaryInterceptor(
+		interceptors.UnaryClientInterceptorOfRetry(
+			interceptors.WithHedging(time.Minute, "/internal.proto.EchoService/"),
+			interceptors.WithBackoff(100*time.Millisecond, 100*time.Millisecond),
+			interceptors.WithBackoffJitter(0),
+		),
+	))
+
+	// 请求失败后等待 backoff 再发起下一次
+	start := time.Now()
+	if _, err := client.Echo(context.Background(), &pb.Message{Value: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost < 100*time.Millisecond || cost > 10*time.Second {
+		t.Errorf("unexpected cost %v", cost)
+	}
+}
@@ -0,0 +1,111 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/limingyao/excellent-go/encoding/prototext"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// StreamClientInterceptorOfMetadata inject session_id and propagate keys to metadata
+func StreamClientInterceptorOfMetadata(opts ...MetadataOption) grpc.StreamClientInterceptor {
+	o := metadataOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = o.outgoingContext(ctx)
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// sessionIdClientStream inject session_id to every request
+type sessionIdClientStream struct {
+	grpc.ClientStream
+	sessionId string
+}
+
+func (s *sessionIdClientStream) SendMsg(m interface{}) error {
+	if req, ok := m.(proto.Message); ok && req != nil {
+		p := proto.MessageReflect(req)
+		if field := p.Descriptor().Fields().ByName(protoSessionIdFieldName); field != nil {
+			p.Set(field, protoreflect.ValueOfString(s.sessionId))
+		}
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+// StreamClientInterceptorOfSessionId inject session_id to request
+func StreamClientInterceptorOfSessionId() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, sessionId := sessionIdFromContext(ctx)
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &sessionIdClientStream{ClientStream: stream, sessionId: sessionId}, nil
+	}
+}
+
+// debugClientStream print every request, response, print cost when stream finished
+type debugClientStream struct {
+	grpc.ClientStream
+	logger *log.Entry
+	start  time.Time
+	once   sync.Once
+}
+
+func (s *debugClientStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok {
+		s.logger.Infof("request: %s", prototext.CompactTextString(msg))
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *debugClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		if msg, ok := m.(proto.Message); ok {
+			s.logger.Infof("response: %s", prototext.CompactTextString(msg))
+		}
+		return nil
+	}
+
+	s.once.Do(func() {
+		cost := time.Since(s.start)
+		if errors.Is(err, io.EOF) {
+			s.logger.Infof("cost: %v", cost)
+		} else {
+			s.logger.WithError(err).Infof("cost: %v", cost)
+		}
+	})
+	return err
+}
+
+// StreamClientInterceptorOfDebug print request, response
+func StreamClientInterceptorOfDebug() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, sessionId := sessionIdFromContext(ctx)
+		logger := log.WithField(CtxSessionIdKey, sessionId).WithField("method", method)
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			logger.WithError(err).Infof("cost: %v", time.Since(start))
+			return nil, err
+		}
+		return &debugClientStream{ClientStream: stream, logger: logger, start: start}, nil
+	}
+}
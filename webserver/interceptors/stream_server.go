@@ -0,0 +1,109 @@
+package interceptors
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/limingyao/excellent-go/encoding/prototext"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// StreamServerInterceptorOfRecovery recovery
+func StreamServerInterceptorOfRecovery() grpc.StreamServerInterceptor {
+	return grpcrecovery.StreamServerInterceptor(grpcrecovery.WithRecoveryHandler(recoveryHandler))
+}
+
+// StreamServerInterceptorOfContext inject session_id, client_ip to stream context,
+// session_id 只从 metadata 读取，handler 开始前确定，不读取请求中的 session_id
+func StreamServerInterceptorOfContext() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, ok := metadata.FromIncomingContext(ss.Context())
+		if !ok {
+			return status.Errorf(codes.Internal, "%s", "incoming metadata invalid")
+		}
+
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = contextFromMetadata(wrapped.WrappedContext, md)
+
+		return handler(srv, wrapped)
+	}
+}
+
+// sessionIdServerStream inject session_id to every response
+type sessionIdServerStream struct {
+	*grpcmiddleware.WrappedServerStream
+	sessionId string
+}
+
+func (s *sessionIdServerStream) SendMsg(m interface{}) error {
+	if resp, ok := m.(proto.Message); ok && resp != nil {
+		p := proto.MessageReflect(resp)
+		if field := p.Descriptor().Fields().ByName(protoSessionIdFieldName); field != nil {
+			p.Set(field, protoreflect.ValueOfString(s.sessionId))
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// StreamServerInterceptorOfSessionId inject session_id to response
+func StreamServerInterceptorOfSessionId() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		ctx, sessionId := sessionIdFromContext(wrapped.WrappedContext)
+		wrapped.WrappedContext = ctx
+
+		return handler(srv, &sessionIdServerStream{WrappedServerStream: wrapped, sessionId: sessionId})
+	}
+}
+
+// debugServerStream print every request, response
+type debugServerStream struct {
+	grpc.ServerStream
+	logger *log.Entry
+}
+
+func (s *debugServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		if msg, ok := m.(proto.Message); ok {
+			s.logger.Infof("request: %s", prototext.CompactTextString(msg))
+		}
+	}
+	return err
+}
+
+func (s *debugServerStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok {
+		s.logger.Infof("response: %s", prototext.CompactTextString(msg))
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// StreamServerInterceptorOfDebug print request, response
+func StreamServerInterceptorOfDebug() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		ctx, sessionId := sessionIdFromContext(wrapped.WrappedContext)
+		wrapped.WrappedContext = ctx
+		logger := log.WithField(CtxSessionIdKey, sessionId).WithField("method", info.FullMethod)
+
+		start := time.Now()
+		err := handler(srv, &debugServerStream{ServerStream: wrapped, logger: logger})
+		cost := time.Since(start)
+
+		if err != nil {
+			logger.WithError(err).Infof("cost: %v", cost)
+		} else {
+			logger.Infof("cost: %v", cost)
+		}
+
+		return err
+	}
+}
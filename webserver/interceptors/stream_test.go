@@ -0,0 +1,180 @@
+package interceptors_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// echoStream 每个请求返回一个响应，value 为请求 value 和 session id
+func echoStream(_ interface{}, ss grpc.ServerStream) error {
+	for {
+		req := &pb.Message{}
+		if err := ss.RecvMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if req.Value == "panic" {
+			panic("stream panic")
+		}
+		sessionId := interceptors.SessionIDFromContext(ss.Context())
+		if err := ss.SendMsg(&pb.Message{Value: req.Value + ":" + sessionId}); err != nil {
+			return err
+		}
+	}
+}
+
+// callStream 发送所有请求后读取全部响应
+func callStream(ctx context.Context, cc *grpc.ClientConn, values ...string) ([]string, error) {
+	stream, err := cc.NewStream(ctx, streamDesc, streamMethod)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if err := stream.SendMsg(&pb.Message{Value: value}); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var replies []string
+	for {
+		reply := &pb.Message{}
+		if err := stream.RecvMsg(reply); err != nil {
+			if errors.Is(err, io.EOF) {
+				return replies, nil
+			}
+			return replies, err
+		}
+		replies = append(replies, reply.Value)
+	}
+}
+
+func TestStreamServerRecovery(t *testing.T) {
+	cc := newStreamConn(t, echoStream, []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(interceptors.StreamServerInterceptorOfRecovery()),
+	})
+
+	replies, err := callStream(context.Background(), cc, "a", "panic")
+	if status.Code(err) != codes.Internal || !strings.Contains(status.Convert(err).Message(), "stream panic") {
+		t.Errorf("expect internal error, got %v", err)
+	}
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "a:") {
+		t.Errorf("unexpected replies %v", replies)
+	}
+
+	// 服务仍然可用
+	if _, err := callStream(context.Background(), cc, "b"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamSessionId(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	cc := newStreamConn(t, echoStream, []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(
+			interceptors.StreamServerInterceptorOfContext(),
+			interceptors.StreamServerInterceptorOfSessionId(),
+			interceptors.StreamServerInterceptorOfDebug(),
+		),
+	}, grpc.WithChainStreamInterceptor(
+		interceptors.StreamClientInterceptorOfMetadata(),
+		interceptors.StreamClientInterceptorOfSessionId(),
+		interceptors.StreamClientInterceptorOfDebug(),
+	))
+
+	ctx := interceptors.WithSessionID(context.Background(), "session")
+	replies, err := callStream(ctx, cc, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// session id 通过 metadata 传递给服务端
+	if strings.Join(replies, ",") != "a:session,b:session" {
+		t.Errorf("unexpected replies %v", replies)
+	}
+
+	// 客户端和服务端各打印两次请求和响应
+	counts := make(map[string]int)
+	for _, entry := range hook.AllEntries() {
+		if entry.Data[interceptors.CtxSessionIdKey] != "session" {
+			t.Errorf("unexpected session id %v in %q", entry.Data[interceptors.CtxSessionIdKey], entry.Message)
+		}
+		if entry.Data["method"] != streamMethod {
+			t.Errorf("unexpected method %v in %q", entry.Data["method"], entry.Message)
+		}
+		counts[strings.SplitN(entry.Message, ":", 2)[0]]++
+	}
+	if counts["request"] != 4 || counts["response"] != 4 || counts["cost"] < 1 {
+		t.Errorf("unexpected debug entries %v", counts)
+	}
+
+	// 没有 session id 时客户端生成，服务端使用相同的 session id
+	replies, err = callStream(context.Background(), cc, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || len(strings.TrimPrefix(replies[0], "c:")) < 1 {
+		t.Errorf("unexpected replies %v", replies)
+	}
+}
+
+// rawCodec 非 proto 的 codec，消息类型为 *[]byte
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "raw"
+}
+
+func TestStreamDebugWithoutProto(t *testing.T) {
+	encoding.RegisterCodec(rawCodec{})
+	cc := newStreamConn(t, func(_ interface{}, ss grpc.ServerStream) error {
+		var msg []byte
+		if err := ss.RecvMsg(&msg); err != nil {
+			return err
+		}
+		return ss.SendMsg(&msg)
+	}, []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(interceptors.StreamServerInterceptorOfDebug()),
+	}, grpc.WithChainStreamInterceptor(interceptors.StreamClientInterceptorOfDebug()))
+
+	stream, err := cc.NewStream(context.Background(), streamDesc, streamMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("raw")
+	if err := stream.SendMsg(&msg); err != nil {
+		t.Fatal(err)
+	}
+	var reply []byte
+	if err := stream.RecvMsg(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "raw" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+}
@@ -0,0 +1,203 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/limingyao/excellent-go/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const tracerName = "github.com/limingyao/excellent-go/webserver/interceptors"
+
+// metadataCarrier adapts metadata.MD to propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// rpcAttributes full method: /package.Service/Method
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
+	}
+	return attrs
+}
+
+// sessionIdAttribute session id from context, fallback to metadata
+func sessionIdAttribute(ctx context.Context, md metadata.MD) []attribute.KeyValue {
+	if sessionId := SessionIDFromContext(ctx); len(sessionId) > 0 {
+		return []attribute.KeyValue{tracing.SessionKey.String(sessionId)}
+	}
+	if sessionIds := md.Get(metadataSessionIdKey); len(sessionIds) > 0 {
+		return []attribute.KeyValue{tracing.SessionKey.String(sessionIds[0])}
+	}
+	return nil
+}
+
+func endSpan(span trace.Span, err error) {
+	s, _ := status.FromError(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(s.Code())))
+	if s.Code() != codes.OK {
+		span.SetStatus(otelcodes.Error, s.Message())
+	}
+	span.End()
+}
+
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	return otel.Tracer(tracerName).Start(ctx, strings.TrimPrefix(fullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(rpcAttributes(fullMethod)...),
+		trace.WithAttributes(sessionIdAttribute(ctx, md)...),
+	)
+}
+
+func startClientSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(rpcAttributes(method)...),
+		trace.WithAttributes(sessionIdAttribute(ctx, nil)...),
+	)
+
+	// inject trace context, keep the existing outgoing metadata
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// UnaryServerInterceptorOfTracing extract trace context from metadata and start server span
+func UnaryServerInterceptorOfTracing() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+
+		resp, err = handler(ctx, req)
+
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptorOfTracing extract trace context from metadata and start server span
+func StreamServerInterceptorOfTracing() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		ctx, span := startServerSpan(wrapped.WrappedContext, info.FullMethod)
+		wrapped.WrappedContext = ctx
+
+		err := handler(srv, wrapped)
+
+		endSpan(span, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptorOfTracing start client span and inject trace context to metadata
+func UnaryClientInterceptorOfTracing() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, resp interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, method)
+
+		err := invoker(ctx, method, req, resp, cc, opts...)
+
+		endSpan(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptorOfTracing start client span and inject trace context to metadata,
+// end span when the stream finished, including received io.EOF, error and ctx canceled
+func StreamClientInterceptorOfTracing() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, method)
+		var once sync.Once
+		done := func(err error) {
+			once.Do(func() {
+				endSpan(span, err)
+			})
+		}
+
+		// grpc 在流结束或 ctx 结束时调用 OnFinish
+		stream, err := streamer(ctx, desc, cc, method, append(opts, grpc.OnFinish(done))...)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// HttpHandlerOfTracing extract trace context from http headers and start server span,
+// gateway calls made with the request context join the same trace
+func HttpHandlerOfTracing(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		attrs := []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPTargetKey.String(r.URL.Path),
+			semconv.HTTPRouteKey.String(route),
+		}
+		if sessionId := r.Header.Get(metadataSessionIdKey); len(sessionId) > 0 {
+			attrs = append(attrs, tracing.SessionKey.String(sessionId))
+		}
+		ctx, span := otel.Tracer(tracerName).Start(ctx, fmt.Sprintf("HTTP %s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		mw := &statusResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(mw, r.WithContext(ctx))
+		if mw.code == 0 {
+			mw.code = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(mw.code))
+		if mw.code >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(mw.code))
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package interceptors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+)
+
+func TestStreamClientTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(provider)
+
+	cc := newStreamConn(t, echoStream, nil, grpc.WithChainStreamInterceptor(interceptors.StreamClientInterceptorOfTracing()))
+
+	// 读取到 io.EOF 时结束 span
+	if _, err := callStream(context.Background(), cc, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Ended(); len(spans) != 1 || spans[0].Status().Code != otelcodes.Unset {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+
+	// 不读取到 io.EOF，直接取消
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(ctx, streamDesc, streamMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&pb.Message{Value: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&pb.Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Ended(); len(spans) != 1 {
+		t.Fatalf("expect stream span not ended, got %d spans", len(spans))
+	}
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Ended()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("span not ended after cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if span := recorder.Ended()[1]; span.Status().Code != otelcodes.Error {
+		t.Errorf("unexpected status %v", span.Status())
+	}
+}
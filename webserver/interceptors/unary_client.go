@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/google/uuid"
 	"github.com/limingyao/excellent-go/encoding/prototext"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -13,20 +12,60 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-// UnaryClientInterceptorOfMetadata inject session_id to metadata
-func UnaryClientInterceptorOfMetadata() grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, resp interface{},
-		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		sessionId, ok := ctx.Value(CtxSessionIdKey).(string)
-		if !ok || len(sessionId) < 1 {
-			sessionId = uuid.New().String()
-			ctx = context.WithValue(ctx, CtxSessionIdKey, sessionId)
+type metadataOptions struct {
+	propagateKeys []string // 从 incoming metadata 透传到 outgoing metadata 的 key
+}
+
+type MetadataOption func(*metadataOptions)
+
+// WithPropagateKeys 透传 incoming metadata 中的 key 到下游调用，如 X-User-Id, X-Tenant-Id, baggage
+func WithPropagateKeys(keys ...string) MetadataOption {
+	return func(o *metadataOptions) {
+		o.propagateKeys = append(o.propagateKeys, keys...)
+	}
+}
+
+// outgoingContext 合并已有的 outgoing metadata，注入 session_id 和透传的 key，
+// context 中没有 session_id 时使用调用方设置的 X-Session-Id，都没有时生成
+func (o metadataOptions) outgoingContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+
+	if len(SessionIDFromContext(ctx)) < 1 {
+		if values := md.Get(metadataSessionIdKey); len(values) > 0 && len(values[0]) > 0 {
+			ctx = WithSessionID(ctx, values[0])
 		}
+	}
+	ctx, sessionId := sessionIdFromContext(ctx)
 
-		md := map[string]string{
-			metadataSessionIdKey: sessionId,
+	if incoming, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range o.propagateKeys {
+			// 调用方设置的值优先
+			if values := incoming.Get(key); len(values) > 0 && len(md.Get(key)) < 1 {
+				md.Set(key, values...)
+			}
 		}
-		ctx = metadata.NewOutgoingContext(ctx, metadata.New(md))
+	}
+	if len(md.Get(metadataSessionIdKey)) < 1 {
+		md.Set(metadataSessionIdKey, sessionId)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientInterceptorOfMetadata inject session_id and propagate keys to metadata
+func UnaryClientInterceptorOfMetadata(opts ...MetadataOption) grpc.UnaryClientInterceptor {
+	o := metadataOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(ctx context.Context, method string, req, resp interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = o.outgoingContext(ctx)
 
 		return invoker(ctx, method, req, resp, cc, opts...)
 	}
@@ -36,11 +75,7 @@ func UnaryClientInterceptorOfMetadata() grpc.UnaryClientInterceptor {
 func UnaryClientInterceptorOfSessionId() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, resp interface{},
 		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		sessionId, ok := ctx.Value(CtxSessionIdKey).(string)
-		if !ok || len(sessionId) < 1 {
-			sessionId = uuid.New().String()
-			ctx = context.WithValue(ctx, CtxSessionIdKey, sessionId)
-		}
+		ctx, sessionId := sessionIdFromContext(ctx)
 
 		// inject session id
 		p := proto.MessageReflect(req.(proto.Message))
@@ -56,12 +91,11 @@ func UnaryClientInterceptorOfSessionId() grpc.UnaryClientInterceptor {
 func UnaryClientInterceptorOfDebug() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, resp interface{},
 		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		sessionId, ok := ctx.Value(CtxSessionIdKey).(string)
-		if !ok || len(sessionId) < 1 {
-			sessionId = uuid.New().String()
-			ctx = context.WithValue(ctx, CtxSessionIdKey, sessionId)
-		}
+		ctx, sessionId := sessionIdFromContext(ctx)
 		logger := log.WithField(CtxSessionIdKey, sessionId)
+		if attempt := attemptFromContext(ctx); attempt > 0 {
+			logger = logger.WithField("attempt", attempt)
+		}
 
 		// print request
 		if req != nil {
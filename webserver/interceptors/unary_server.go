@@ -32,21 +32,20 @@ const (
 	metadataRemoteAddrKey = "X-Appengine-Remote-Addr"
 	metadataSessionIdKey  = "X-Session-Id"
 
-	CtxClientKey    = "client_ip"  // context keys
-	CtxSessionIdKey = "session_id" // context keys
+	// 日志字段名，作为 context key 已废弃，使用 ClientIPFromContext, SessionIDFromContext
+	CtxClientKey    = "client_ip"
+	CtxSessionIdKey = "session_id"
 )
 
+func recoveryHandler(p interface{}) error {
+	_, _ = os.Stderr.Write([]byte(fmt.Sprintf("panic recovered: %s", p)))
+	debug.PrintStack()
+	return status.Errorf(codes.Internal, "%s", p)
+}
+
 // UnaryServerInterceptorOfRecovery recovery
 func UnaryServerInterceptorOfRecovery() grpc.UnaryServerInterceptor {
-	return grpcrecovery.UnaryServerInterceptor(
-		grpcrecovery.WithRecoveryHandler(
-			func(p interface{}) error {
-				_, _ = os.Stderr.Write([]byte(fmt.Sprintf("panic recovered: %s", p)))
-				debug.PrintStack()
-				return status.Errorf(codes.Internal, "%s", p)
-			},
-		),
-	)
+	return grpcrecovery.UnaryServerInterceptor(grpcrecovery.WithRecoveryHandler(recoveryHandler))
 }
 
 // UnaryServerInterceptorOfContext inject session_id, client_ip to context
@@ -59,32 +58,12 @@ func UnaryServerInterceptorOfContext() grpc.UnaryServerInterceptor {
 			return nil, status.Errorf(codes.Internal, "%s", "incoming metadata invalid")
 		}
 
-		// inject session id
-		if ctx.Value(CtxSessionIdKey) == nil {
-			sessionIds := md.Get(metadataSessionIdKey)
-			if len(sessionIds) > 0 {
-				ctx = context.WithValue(ctx, CtxSessionIdKey, sessionIds[0])
-			} else if req, ok := req.(protoRequest); ok && req != nil {
-				ctx = context.WithValue(ctx, CtxSessionIdKey, req.GetSessionId())
-			}
-		}
+		ctx = contextFromMetadata(ctx, md)
 
-		// inject client ip
-		if ctx.Value(CtxClientKey) == nil {
-			// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Forwarded-For
-			// https://cloud.google.com/appengine/docs/flexible/python/reference/request-headers
-			found := false
-			if ips := md.Get(metadataForwardedKey); len(ips) > 0 {
-				found = true
-				ctx = context.WithValue(ctx, CtxClientKey, strings.TrimSpace(strings.Split(ips[0], ",")[0]))
-			}
-			if ips := md.Get(metadataRealIpKey); !found && len(ips) > 0 {
-				found = true
-				ctx = context.WithValue(ctx, CtxClientKey, strings.TrimSpace(ips[0]))
-			}
-			if ips := md.Get(metadataRemoteAddrKey); !found && len(ips) > 0 {
-				found = true
-				ctx = context.WithValue(ctx, CtxClientKey, strings.TrimSpace(ips[0]))
+		// inject session id from request
+		if len(SessionIDFromContext(ctx)) < 1 {
+			if req, ok := req.(protoRequest); ok && req != nil {
+				ctx = WithSessionID(ctx, req.GetSessionId())
 			}
 		}
 
@@ -97,11 +76,7 @@ func UnaryServerInterceptorOfSessionId() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
 	) (resp interface{}, err error) {
-		sessionId, ok := ctx.Value(CtxSessionIdKey).(string)
-		if !ok || len(sessionId) < 1 {
-			sessionId = uuid.New().String()
-			ctx = context.WithValue(ctx, CtxSessionIdKey, sessionId)
-		}
+		ctx, sessionId := sessionIdFromContext(ctx)
 
 		resp, err = handler(ctx, req)
 
@@ -120,11 +95,7 @@ func UnaryServerInterceptorOfDebug() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
 	) (resp interface{}, err error) {
-		sessionId, ok := ctx.Value(CtxSessionIdKey).(string)
-		if !ok || len(sessionId) < 1 {
-			sessionId = uuid.New().String()
-			ctx = context.WithValue(ctx, CtxSessionIdKey, sessionId)
-		}
+		ctx, sessionId := sessionIdFromContext(ctx)
 		logger := log.WithField(CtxSessionIdKey, sessionId)
 
 		// print request
@@ -148,3 +119,38 @@ func UnaryServerInterceptorOfDebug() grpc.UnaryServerInterceptor {
 		return resp, err
 	}
 }
+
+// contextFromMetadata inject session_id, client_ip from metadata to context
+func contextFromMetadata(ctx context.Context, md metadata.MD) context.Context {
+	// inject session id
+	if len(SessionIDFromContext(ctx)) < 1 {
+		if sessionIds := md.Get(metadataSessionIdKey); len(sessionIds) > 0 {
+			ctx = WithSessionID(ctx, sessionIds[0])
+		}
+	}
+
+	// inject client ip
+	if _, ok := ctx.Value(clientIpKey{}).(string); !ok {
+		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Forwarded-For
+		// https://cloud.google.com/appengine/docs/flexible/python/reference/request-headers
+		if ips := md.Get(metadataForwardedKey); len(ips) > 0 {
+			ctx = WithClientIP(ctx, strings.TrimSpace(strings.Split(ips[0], ",")[0]))
+		} else if ips := md.Get(metadataRealIpKey); len(ips) > 0 {
+			ctx = WithClientIP(ctx, strings.TrimSpace(ips[0]))
+		} else if ips := md.Get(metadataRemoteAddrKey); len(ips) > 0 {
+			ctx = WithClientIP(ctx, strings.TrimSpace(ips[0]))
+		}
+	}
+
+	return ctx
+}
+
+// sessionIdFromContext get session_id from context, generate one if not exists
+func sessionIdFromContext(ctx context.Context) (context.Context, string) {
+	sessionId := SessionIDFromContext(ctx)
+	if len(sessionId) < 1 {
+		sessionId = uuid.New().String()
+		ctx = WithSessionID(ctx, sessionId)
+	}
+	return ctx, sessionId
+}
@@ -0,0 +1,115 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// protoc-gen-validate 生成的方法
+type (
+	validator interface {
+		Validate() error
+	}
+	allValidator interface {
+		ValidateAll() error
+	}
+	// fieldError 字段校验错误，如 MessageValidationError
+	fieldError interface {
+		Field() string
+		Reason() string
+	}
+	// causer 嵌套消息的校验错误
+	causer interface {
+		Cause() error
+	}
+	// multiError ValidateAll 返回的错误，如 MessageMultiError
+	multiError interface {
+		AllErrors() []error
+	}
+)
+
+// fieldViolations 展开嵌套消息和 ValidateAll 的错误，字段名以 . 连接
+func fieldViolations(prefix string, err error) []*errdetails.BadRequest_FieldViolation {
+	var multi multiError
+	if errors.As(err, &multi) {
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, e := range multi.AllErrors() {
+			violations = append(violations, fieldViolations(prefix, e)...)
+		}
+		return violations
+	}
+
+	var fe fieldError
+	if !errors.As(err, &fe) {
+		return []*errdetails.BadRequest_FieldViolation{{Field: prefix, Description: err.Error()}}
+	}
+
+	field := fe.Field()
+	if len(prefix) > 0 {
+		field = prefix + "." + field
+	}
+	if c, ok := fe.(causer); ok && c.Cause() != nil {
+		var nested fieldError
+		var nestedMulti multiError
+		if errors.As(c.Cause(), &nested) || errors.As(c.Cause(), &nestedMulti) {
+			return fieldViolations(field, c.Cause())
+		}
+	}
+	return []*errdetails.BadRequest_FieldViolation{{Field: field, Description: fe.Reason()}}
+}
+
+// validate 优先调用 ValidateAll，失败时返回带 errdetails.BadRequest 的 InvalidArgument
+func validate(req interface{}) error {
+	var err error
+	switch v := req.(type) {
+	case allValidator:
+		err = v.ValidateAll()
+	case validator:
+		err = v.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+
+	s := status.New(codes.InvalidArgument, err.Error())
+	if ds, e := s.WithDetails(&errdetails.BadRequest{FieldViolations: fieldViolations("", err)}); e == nil {
+		s = ds
+	}
+	return s.Err()
+}
+
+// UnaryServerInterceptorOfValidate 调用请求的 ValidateAll 或 Validate 方法，gateway 将 BadRequest 渲染到 details 中
+func UnaryServerInterceptorOfValidate() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		if err := validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// validateServerStream validate every received request
+type validateServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *validateServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+// StreamServerInterceptorOfValidate 校验每个收到的请求
+func StreamServerInterceptorOfValidate() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validateServerStream{ServerStream: ss})
+	}
+}
@@ -0,0 +1,84 @@
+package interceptors_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validationError protoc-gen-validate 生成的错误
+type validationError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e validationError) Field() string  { return e.field }
+func (e validationError) Reason() string { return e.reason }
+func (e validationError) Cause() error   { return e.cause }
+func (e validationError) Error() string  { return fmt.Sprintf("invalid %s: %s", e.field, e.reason) }
+
+type multiError []error
+
+func (m multiError) Error() string      { return fmt.Sprintf("%d errors", len(m)) }
+func (m multiError) AllErrors() []error { return m }
+
+type request struct{}
+
+func (request) ValidateAll() error {
+	return multiError{
+		validationError{field: "Name", reason: "value length must be at least 1 runes"},
+		validationError{field: "Address", reason: "embedded message failed validation", cause: multiError{
+			validationError{field: "City", reason: "value is required"},
+		}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	interceptor := interceptors.UnaryServerInterceptorOfValidate()
+	_, err := interceptor(context.Background(), request{}, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Error("handler should not be called")
+			return nil, nil
+		})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expect InvalidArgument, got %v", err)
+	}
+
+	// gateway 渲染为结构化 json
+	rec := httptest.NewRecorder()
+	mux := runtime.NewServeMux()
+	runtime.HTTPError(context.Background(), mux, &runtime.JSONPb{}, rec, httptest.NewRequest(http.MethodGet, "/", nil), err)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expect 400, got %d", rec.Code)
+	}
+
+	var body struct {
+		Details []struct {
+			FieldViolations []struct {
+				Field       string `json:"field"`
+				Description string `json:"description"`
+			} `json:"fieldViolations"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Details) != 1 || len(body.Details[0].FieldViolations) != 2 {
+		t.Fatalf("unexpected body %s", rec.Body)
+	}
+	for i, field := range []string{"Name", "Address.City"} {
+		if violation := body.Details[0].FieldViolations[i]; violation.Field != field {
+			t.Errorf("expect %s, got %s", field, violation.Field)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package webserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/limingyao/excellent-go/encoding"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
+)
+
+// mimePrettyJSON ?pretty 时使用的 Accept，仅用于选择 marshaler
+const mimePrettyJSON = "application/json+pretty"
+
+// protobufMarshaler 使用 encoding.MIMEPROTOBUF 作为 Content-Type
+type protobufMarshaler struct {
+	runtime.ProtoMarshaller
+}
+
+func (*protobufMarshaler) ContentType(_ interface{}) string {
+	return encoding.MIMEPROTOBUF
+}
+
+// convertMarshaler 先通过 protojson 转换为通用结构，再编码为 yaml, msgpack 等格式，字段名与 json 一致
+type convertMarshaler struct {
+	runtime.JSONPb
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+func (m *convertMarshaler) ContentType(_ interface{}) string {
+	return m.contentType
+}
+
+func (m *convertMarshaler) Marshal(v interface{}) ([]byte, error) {
+	b, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return nil, err
+	}
+	return m.marshal(x)
+}
+
+func (m *convertMarshaler) Unmarshal(data []byte, v interface{}) error {
+	var x interface{}
+	if err := m.unmarshal(data, &x); err != nil {
+		return err
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	return m.JSONPb.Unmarshal(b, v)
+}
+
+func (m *convertMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if len(data) < 1 {
+			return io.EOF
+		}
+		return m.Unmarshal(data, v)
+	})
+}
+
+func (m *convertMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v interface{}) error {
+		b, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	})
+}
+
+// defaultMarshalerOptions json, protobuf, yaml, msgpack，按 Accept 和 Content-Type 选择
+func defaultMarshalerOptions() []runtime.ServeMuxOption {
+	jsonPb := runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	prettyPb := jsonPb
+	prettyPb.MarshalOptions.Multiline = true
+	prettyPb.MarshalOptions.Indent = "  "
+
+	yamlPb := &convertMarshaler{
+		JSONPb: jsonPb, contentType: encoding.MIMEYAML, marshal: yaml.Marshal, unmarshal: yaml.Unmarshal,
+	}
+	msgpackPb := &convertMarshaler{
+		JSONPb: jsonPb, contentType: encoding.MIMEMSGPACK, marshal: msgpack.Marshal, unmarshal: msgpack.Unmarshal,
+	}
+
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &jsonPb),
+		runtime.WithMarshalerOption(encoding.MIMEJSON, &jsonPb),
+		runtime.WithMarshalerOption(mimePrettyJSON, &prettyPb),
+		runtime.WithMarshalerOption(encoding.MIMEPROTOBUF, &protobufMarshaler{}),
+		runtime.WithMarshalerOption(encoding.MIMEYAML, yamlPb),
+		runtime.WithMarshalerOption(encoding.MIMEMSGPACK, msgpackPb),
+		runtime.WithMarshalerOption(encoding.MIMEMSGPACK2, msgpackPb),
+	}
+}
+
+// prettyHandler 请求带 ?pretty 时返回格式化的 json
+func prettyHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["pretty"]; ok {
+			r.Header.Set("Accept", mimePrettyJSON)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
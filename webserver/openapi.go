@@ -0,0 +1,176 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/limingyao/excellent-go/encoding"
+	swaggerfiles "github.com/swaggo/files/v2"
+)
+
+var swaggerUITemplate = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>Swagger UI</title>
+  <link rel="stylesheet" href="{{.Assets}}/swagger-ui.css" />
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js" crossorigin></script>
+<script>
+  window.onload = () => {
+    window.ui = SwaggerUIBundle({url: {{.URL}}, dom_id: '#swagger-ui'});
+  };
+</script>
+</body>
+</html>
+`))
+
+// swaggerMapKeys 按 key 合并的字段，同名时后面的文件覆盖前面的
+var swaggerMapKeys = []string{"paths", "definitions", "parameters", "responses", "securityDefinitions"}
+
+// swaggerListKeys 合并后去重的字段
+var swaggerListKeys = []string{"consumes", "produces", "schemes"}
+
+// mergeSwagger 合并 specFS 中所有的 *.swagger.json，info, host, basePath, security 使用第一个文件的配置
+func mergeSwagger(specFS fs.FS) ([]byte, error) {
+	merged := map[string]interface{}{"swagger": "2.0"}
+	tags := make(map[string]bool)
+
+	err := fs.WalkDir(specFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".swagger.json") {
+			return nil
+		}
+
+		b, err := fs.ReadFile(specFS, path)
+		if err != nil {
+			return err
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+
+		for _, key := range []string{"info", "host", "basePath", "security"} {
+			if _, ok := merged[key]; !ok && doc[key] != nil {
+				merged[key] = doc[key]
+			}
+		}
+		for _, key := range swaggerMapKeys {
+			values, _ := doc[key].(map[string]interface{})
+			if len(values) < 1 {
+				continue
+			}
+			m, _ := merged[key].(map[string]interface{})
+			if m == nil {
+				m = make(map[string]interface{}, len(values))
+				merged[key] = m
+			}
+			for k, v := range values {
+				m[k] = v
+			}
+		}
+		for _, key := range swaggerListKeys {
+			values, _ := doc[key].([]interface{})
+			list, _ := merged[key].([]interface{})
+			for _, v := range values {
+				if !containsValue(list, v) {
+					list = append(list, v)
+				}
+			}
+			if len(list) > 0 {
+				merged[key] = list
+			}
+		}
+		values, _ := doc["tags"].([]interface{})
+		for _, v := range values {
+			tag, _ := v.(map[string]interface{})
+			name, _ := tag["name"].(string)
+			if tags[name] {
+				continue
+			}
+			tags[name] = true
+			list, _ := merged["tags"].([]interface{})
+			merged["tags"] = append(list, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := merged["paths"]; !ok {
+		merged["paths"] = map[string]interface{}{}
+	}
+	if _, ok := merged["info"]; !ok {
+		merged["info"] = map[string]interface{}{"title": "API", "version": "version not set"}
+	}
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// registerOpenAPI 文档在启动时合并，文件格式错误时启动失败
+func (s *Webserver) registerOpenAPI() error {
+	spec, err := mergeSwagger(s.openapiFS)
+	if err != nil {
+		return err
+	}
+	s.httpMux.HandleFunc(s.openapiPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", encoding.MIMEJSON)
+		_, _ = w.Write(spec)
+	})
+	if len(s.swaggerUIPath) < 1 {
+		return nil
+	}
+
+	// 内嵌的静态资源在 path/ 下提供
+	assets := strings.TrimSuffix(s.swaggerUIAssets, "/")
+	embedded := len(assets) < 1
+	assetsPrefix := strings.TrimSuffix(s.swaggerUIPath, "/") + "/"
+	if embedded {
+		assets = strings.TrimSuffix(assetsPrefix, "/")
+	}
+	var page bytes.Buffer
+	if err := swaggerUITemplate.Execute(&page, map[string]string{"Assets": assets, "URL": s.openapiPath}); err != nil {
+		return err
+	}
+	pageHandler := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", encoding.MIMEHTML)
+		_, _ = w.Write(page.Bytes())
+	}
+	if !embedded {
+		s.httpMux.HandleFunc(s.swaggerUIPath, pageHandler)
+		return nil
+	}
+
+	files := http.StripPrefix(assetsPrefix, http.FileServer(http.FS(swaggerfiles.FS)))
+	if s.swaggerUIPath != assetsPrefix {
+		s.httpMux.HandleFunc(s.swaggerUIPath, pageHandler)
+		s.httpMux.Handle(assetsPrefix, files)
+		return nil
+	}
+	s.httpMux.HandleFunc(assetsPrefix, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == assetsPrefix {
+			pageHandler(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+	return nil
+}
@@ -1,10 +1,15 @@
 package webserver
 
 import (
+	"io/fs"
+	"os"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/limingyao/excellent-go/metrics/prometheus"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
 	"google.golang.org/grpc"
 )
 
@@ -23,6 +28,46 @@ func WithPort(port int) ServerOption {
 	}
 }
 
+// WithAdminAddr pprof, metrics, 健康检查和 reflection 使用单独的内部端口，公开端口只提供注册的业务服务，
+// 内部端口始终使用明文 h2c，ServeTLS 时也不使用证书，便于 kubelet 等探测，不要暴露到集群外
+func WithAdminAddr(ip string, port int) ServerOption {
+	return func(s *Webserver) {
+		s.admin = &admin{ip: ip, port: port}
+	}
+}
+
+// WithUnixSocket 额外监听 unix socket，提供与公开端口相同的服务，如 sidecar 流量，
+// unix socket 始终使用明文 h2c，ServeTLS 时也不使用证书，通过文件权限控制访问
+func WithUnixSocket(path string) ServerOption {
+	return func(s *Webserver) {
+		s.unix = &unixSocket{path: path}
+	}
+}
+
+// WithOpenAPI 合并 specFS 中所有的 *.swagger.json 并在 path 提供，如 WithOpenAPI(os.DirFS("api"), "/swagger.json")
+func WithOpenAPI(specFS fs.FS, path string) ServerOption {
+	return func(s *Webserver) {
+		s.openapiFS = specFS
+		s.openapiPath = path
+	}
+}
+
+// WithSwaggerUI 在 path 提供 swagger ui 页面，展示 WithOpenAPI 的文档，
+// assets 为 swagger-ui-dist 静态资源的地址，为空时使用内嵌的静态资源
+func WithSwaggerUI(path, assets string) ServerOption {
+	return func(s *Webserver) {
+		s.swaggerUIPath = path
+		s.swaggerUIAssets = assets
+	}
+}
+
+// WithRoutesPath 在 path 以 json 返回 gateway 和 http 路由列表
+func WithRoutesPath(path string) ServerOption {
+	return func(s *Webserver) {
+		s.routesPath = path
+	}
+}
+
 func WithGatewayOptions(opts ...runtime.ServeMuxOption) ServerOption {
 	return func(s *Webserver) {
 		s.gatewayOptions = opts
@@ -54,6 +99,40 @@ func WithHealthzPath(path string) ServerOption {
 	}
 }
 
+func WithLivezPath(path string) ServerOption {
+	return func(s *Webserver) {
+		s.enableHealthz = true
+		s.livezPath = strings.TrimSuffix(path, "/")
+	}
+}
+
+func WithReadyzPath(path string) ServerOption {
+	return func(s *Webserver) {
+		s.enableHealthz = true
+		s.readyzPath = strings.TrimSuffix(path, "/")
+	}
+}
+
+// WithReadinessChecker 添加就绪检查，任意检查失败时服务整体状态为 NOT_SERVING
+func WithReadinessChecker(name string, checker Checker) ServerOption {
+	return func(s *Webserver) {
+		s.enableHealthz = true
+		s.healthz.checkers[name] = checker
+	}
+}
+
+// WithReadinessInterval 就绪检查周期，默认 10s，每次检查的超时时间默认 3s，小于等于 0 时使用默认值
+func WithReadinessInterval(interval, timeout time.Duration) ServerOption {
+	return func(s *Webserver) {
+		if interval > 0 {
+			s.readinessInterval = interval
+		}
+		if timeout > 0 {
+			s.readinessTimeout = timeout
+		}
+	}
+}
+
 func WithReflection() ServerOption {
 	return func(s *Webserver) {
 		s.enableReflection = true
@@ -87,3 +166,136 @@ func WithPrometheusPath(path string, opts ...prometheus.Option) ServerOption {
 		s.prometheusPath = strings.TrimSuffix(path, "/")
 	}
 }
+
+// WithTracing grpc, gateway, RegisterHttpHandler 注册的路由开启 opentelemetry tracing，需要先调用 tracing.Init
+func WithTracing() ServerOption {
+	return func(s *Webserver) {
+		s.enableTracing = true
+	}
+}
+
+// WithHttpMetrics RegisterHttpHandler 注册的路由记录 http_server_* 指标，grpc 及 gateway 请求使用 interceptors.UnaryServerInterceptorOfMetrics
+func WithHttpMetrics(opts ...interceptors.MetricsOption) ServerOption {
+	return func(s *Webserver) {
+		s.enableHttpMetrics = true
+		s.httpMetricsOptions = opts
+	}
+}
+
+// WithDefaultMarshalers gateway 支持 json, protobuf, yaml, msgpack，按 Accept 和 Content-Type 选择，请求带 ?pretty 时返回格式化的 json
+func WithDefaultMarshalers() ServerOption {
+	return func(s *Webserver) {
+		s.enableMarshalers = true
+	}
+}
+
+// WithServerSentEvents 请求头 Accept 为 text/event-stream 时，gateway 的 server-streaming 响应以 server-sent events 返回，
+// 每隔 heartbeat 发送 ping 注释，为 0 时不发送
+func WithServerSentEvents(heartbeat time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.enableSSE = true
+		s.sseHeartbeat = heartbeat
+	}
+}
+
+// WithWebSocket gateway 的 bidi-streaming 方法支持 websocket，每个消息对应一个请求或响应，
+// 每隔 heartbeat 发送 ping，2 * heartbeat 内没有收到 pong 时断开，为 0 时不发送
+func WithWebSocket(heartbeat time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.enableWebSocket = true
+		s.wsHeartbeat = heartbeat
+	}
+}
+
+// WithGrpcWeb 支持浏览器通过 http/1.1 使用 grpc-web 调用注册的 grpc 服务，包括 application/grpc-web 和 application/grpc-web-text，
+// 并处理 CORS 预检请求，opts 覆盖默认的跨域配置
+func WithGrpcWeb(opts ...interceptors.CORSOption) ServerOption {
+	return func(s *Webserver) {
+		s.enableGrpcWeb = true
+		s.grpcWebCORSOptions = opts
+	}
+}
+
+// WithHttpMiddleware 添加 http 中间件，按添加顺序由外到内执行，只作用于 gateway 和 RegisterHttpHandler 注册的路由，
+// 如 interceptors.HttpMiddlewareOfCORS, interceptors.HttpMiddlewareOfCompress
+func WithHttpMiddleware(middlewares ...interceptors.HttpMiddleware) ServerOption {
+	return func(s *Webserver) {
+		s.httpMiddlewares = append(s.httpMiddlewares, middlewares...)
+	}
+}
+
+// WithTLS ServeTLS 使用的证书，文件更新后自动重新加载，只作用于公开端口，WithAdminAddr, WithUnixSocket 仍为明文
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(s *Webserver) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// WithClientCA 开启双向认证，客户端证书必须由 caFiles 中的 CA 签发
+func WithClientCA(caFiles ...string) ServerOption {
+	return func(s *Webserver) {
+		s.clientCAFiles = caFiles
+	}
+}
+
+// WithTLSReloadInterval 证书文件检查周期，默认 30s，小于等于 0 时不重新加载
+func WithTLSReloadInterval(interval time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.tlsReloadInterval = interval
+	}
+}
+
+// WithDescriptorSet 从 protoc --include_imports --descriptor_set_out 生成的文件加载服务，
+// 根据 google.api.http 注解将 http 请求转码为 grpc 调用，不需要注册 .pb.gw.go，
+// path 为目录时加载其中所有 .desc, .protoset 文件，文件变更后自动重新加载
+func WithDescriptorSet(paths ...string) ServerOption {
+	return func(s *Webserver) {
+		if s.descriptors == nil {
+			s.descriptors = &descriptorSet{}
+		}
+		s.descriptors.paths = append(s.descriptors.paths, paths...)
+	}
+}
+
+// WithDescriptorSetEndpoint WithDescriptorSet 转发的 grpc 地址，默认连接本服务
+func WithDescriptorSetEndpoint(endpoint string, opts ...grpc.DialOption) ServerOption {
+	return func(s *Webserver) {
+		if s.descriptors == nil {
+			s.descriptors = &descriptorSet{}
+		}
+		s.descriptors.endpoint = endpoint
+		s.descriptors.dialOptions = opts
+	}
+}
+
+// WithDescriptorSetReloadInterval descriptor set 文件检查周期，默认 30s，小于等于 0 时只能通过 ReloadDescriptorSet 重新加载
+func WithDescriptorSetReloadInterval(interval time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.descriptorReloadInterval = interval
+	}
+}
+
+// WithSignalHandling 收到信号后自动调用 Shutdown，Serve 正常返回，默认处理 SIGTERM, SIGINT
+func WithSignalHandling(signals ...os.Signal) ServerOption {
+	return func(s *Webserver) {
+		if len(signals) < 1 {
+			signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+		}
+		s.signals = signals
+	}
+}
+
+// WithDrainPeriod Shutdown 时健康检查置为 NOT_SERVING 后继续处理请求的时长，等待负载均衡摘除流量
+func WithDrainPeriod(period time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.drainPeriod = period
+	}
+}
+
+// WithShutdownTimeout 收到信号后 Shutdown 的最长时间，默认 30s
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *Webserver) {
+		s.shutdownTimeout = timeout
+	}
+}
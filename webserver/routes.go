@@ -0,0 +1,119 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/limingyao/excellent-go/encoding"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Route 路由信息，gateway 路由包含对应的 grpc 方法
+type Route struct {
+	Method     string `json:"method,omitempty"`      // http 方法，RegisterHttpHandler 注册的路由为空
+	Path       string `json:"path"`                  // 路径模板，如 /v1/users/{id}
+	GrpcMethod string `json:"grpc_method,omitempty"` // grpc 方法，如 /package.Service/Method
+	Body       string `json:"body,omitempty"`        // 请求 body 对应的字段，* 表示整个请求
+}
+
+// httpRulePattern 获取 google.api.http 的方法和路径
+func httpRulePattern(rule *annotations.HttpRule) (method, path string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// httpRules 获取方法的 google.api.http 注解，包括 additional_bindings
+func httpRules(md protoreflect.MethodDescriptor) []*annotations.HttpRule {
+	opts := md.Options()
+	if opts == nil || !protov2.HasExtension(opts, annotations.E_Http) {
+		return nil
+	}
+	rule, ok := protov2.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+	rules := []*annotations.HttpRule{rule}
+	return append(rules, rule.GetAdditionalBindings()...)
+}
+
+// serviceRoutes 根据 google.api.http 注解生成服务的 gateway 路由
+func serviceRoutes(sd protoreflect.ServiceDescriptor) []Route {
+	var routes []Route
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		for _, rule := range httpRules(md) {
+			method, path := httpRulePattern(rule)
+			if len(path) < 1 {
+				continue
+			}
+			routes = append(routes, Route{
+				Method:     method,
+				Path:       path,
+				GrpcMethod: "/" + string(sd.FullName()) + "/" + string(md.Name()),
+				Body:       rule.GetBody(),
+			})
+		}
+	}
+	return routes
+}
+
+// findService 从 protoregistry.GlobalFiles 查找 grpc 服务，name 如 package.Service
+func findService(name string) (protoreflect.ServiceDescriptor, error) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("find service %s: %w", name, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+	return sd, nil
+}
+
+// Routes 返回注册 gateway handler 时指定的服务的 google.api.http 路由，WithDescriptorSet 加载的路由，
+// 以及 RegisterHttpHandler 注册的路由
+func (s *Webserver) Routes() []Route {
+	s.mu.Lock()
+	services := append([]protoreflect.ServiceDescriptor(nil), s.gatewayServices...)
+	s.mu.Unlock()
+
+	var routes []Route
+	for _, sd := range services {
+		routes = append(routes, serviceRoutes(sd)...)
+	}
+
+	if s.descriptors != nil {
+		routes = append(routes, s.descriptors.Routes()...)
+	}
+
+	s.mu.Lock()
+	for _, pattern := range s.httpRoutes {
+		routes = append(routes, Route{Path: pattern})
+	}
+	s.mu.Unlock()
+
+	return sortRoutes(routes)
+}
+
+func (s *Webserver) routesHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", encoding.MIMEJSON)
+	_ = json.NewEncoder(w).Encode(s.Routes())
+}
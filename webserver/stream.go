@@ -0,0 +1,329 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const mimeEventStream = "text/event-stream"
+
+// sseResponseWriter gateway 每次 Flush 的响应转换为一个 event，
+// 第一次 Flush 前出错时按原样返回错误，之后的错误以 event: error 返回
+type sseResponseWriter struct {
+	http.ResponseWriter
+	mu      sync.Mutex
+	code    int
+	buf     bytes.Buffer
+	started bool
+	events  int // 已发送的 event 数量
+	closed  bool
+	err     error
+}
+
+func (w *sseResponseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *sseResponseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buf.Write(b)
+}
+
+func (w *sseResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush("")
+}
+
+func (w *sseResponseWriter) start() {
+	w.started = true
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Type", mimeEventStream)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	h.Del("Transfer-Encoding")
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+func (w *sseResponseWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	if _, err := w.ResponseWriter.Write(b); err != nil {
+		w.err = err
+		return
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// flush 多行数据使用多个 data: 字段
+func (w *sseResponseWriter) flush(event string) {
+	if w.closed || w.err != nil {
+		return
+	}
+	if !w.started {
+		w.start()
+	}
+	data := bytes.TrimRight(w.buf.Bytes(), "\r\n")
+	if len(data) < 1 {
+		w.buf.Reset()
+		return
+	}
+
+	var b bytes.Buffer
+	if len(event) > 0 {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(bytes.TrimRight(line, "\r"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	w.buf.Reset()
+	w.events++
+	w.write(b.Bytes())
+}
+
+func (w *sseResponseWriter) ping() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if !w.started {
+		w.start()
+	}
+	w.write([]byte(": ping\n\n"))
+	return w.err
+}
+
+func (w *sseResponseWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case !w.started && w.code >= http.StatusBadRequest:
+		// 还未开始 stream 时的错误，按原样返回
+		w.ResponseWriter.WriteHeader(w.code)
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	case w.events > 0 || w.code >= http.StatusBadRequest:
+		// gateway 在 stream 出错时写入 error 后不会 Flush
+		w.flush("error")
+	default:
+		// unary 方法的响应作为一个 event
+		w.flush("")
+	}
+	w.closed = true
+}
+
+func (w *sseResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sseHandler Accept 为 text/event-stream 时，将 gateway 的 server-streaming 响应转换为 server-sent events，
+// 消息使用 gateway 根据 Content-Type 选择的 marshaler 编码，客户端断开时取消 grpc stream
+func sseHandler(h http.Handler, heartbeat time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), mimeEventStream) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		sw := &sseResponseWriter{ResponseWriter: w}
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		if heartbeat > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(heartbeat)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := sw.ping(); err != nil {
+							cancel()
+							return
+						}
+					case <-done:
+						return
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		h.ServeHTTP(sw, r.WithContext(ctx))
+		close(done)
+		wg.Wait()
+		sw.close()
+	})
+}
+
+// wsResponseWriter gateway 每次 Flush 的响应作为一个 websocket 消息
+type wsResponseWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+	err    error
+}
+
+func (w *wsResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *wsResponseWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buf.Write(b)
+}
+
+// messageType json, yaml 等文本格式使用 TextMessage，其他使用 BinaryMessage
+func (w *wsResponseWriter) messageType() int {
+	contentType := w.header.Get("Content-Type")
+	if len(contentType) < 1 || strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "yaml") || strings.HasPrefix(contentType, "text/") {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func (w *wsResponseWriter) Flush() {
+	data := bytes.TrimRight(w.buf.Bytes(), "\r\n")
+	if w.err != nil || len(data) < 1 {
+		w.buf.Reset()
+		return
+	}
+	w.err = w.conn.WriteMessage(w.messageType(), data)
+	w.buf.Reset()
+}
+
+func (w *wsResponseWriter) close() {
+	w.Flush()
+	code, text := websocket.CloseNormalClosure, ""
+	if w.code >= http.StatusBadRequest {
+		code, text = websocket.CloseInternalServerErr, http.StatusText(w.code)
+	}
+	_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text),
+		time.Now().Add(time.Second))
+}
+
+// websocketHandler websocket 请求转换为 gateway 的 bidi-streaming 请求，每个收到的消息作为 body 中的一个请求，
+// 每个响应作为一个消息，默认使用 POST，可通过 ?method= 指定，客户端正常关闭时结束请求流，异常断开时取消 grpc stream
+func websocketHandler(h http.Handler, heartbeat time.Duration) http.Handler {
+	upgrader := websocket.Upgrader{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.WithError(err).Warn("websocket upgrade fail")
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		pr, pw := io.Pipe()
+		req := r.Clone(ctx)
+		req.Method = http.MethodPost
+		if method := r.URL.Query().Get("method"); len(method) > 0 {
+			req.Method = strings.ToUpper(method)
+		}
+		req.Body = pr
+		req.ContentLength = -1
+		for _, key := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version",
+			"Sec-Websocket-Extensions", "Sec-Websocket-Protocol"} {
+			req.Header.Del(key)
+		}
+
+		if heartbeat > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+			})
+		}
+
+		go func() {
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						_ = pw.Close()
+						return
+					}
+					_ = pw.CloseWithError(err)
+					cancel()
+					return
+				}
+				if _, err := pw.Write(append(msg, '\n')); err != nil {
+					return
+				}
+			}
+		}()
+
+		done := make(chan struct{})
+		defer close(done)
+		if heartbeat > 0 {
+			go func() {
+				ticker := time.NewTicker(heartbeat)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeat)); err != nil {
+							cancel()
+							return
+						}
+					case <-done:
+						return
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		ww := &wsResponseWriter{conn: conn, header: make(http.Header)}
+		h.ServeHTTP(ww, req)
+		_ = pr.Close()
+		ww.close()
+	})
+}
@@ -0,0 +1,211 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+)
+
+// keyPairReloader 从磁盘加载证书，文件变更后自动重新加载，无需重启服务
+type keyPairReloader struct {
+	certFile      string
+	keyFile       string
+	clientCAFiles []string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+}
+
+func newKeyPairReloader(certFile, keyFile string, clientCAFiles []string) (*keyPairReloader, error) {
+	r := &keyPairReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		clientCAFiles: clientCAFiles,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime 返回所有证书文件中最新的修改时间
+func (r *keyPairReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	files := append([]string{r.certFile, r.keyFile}, r.clientCAFiles...)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload 文件有变更时重新加载证书，返回是否发生了重新加载
+func (r *keyPairReloader) reload() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false, err
+		}
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.clientCAFiles) > 0 {
+		clientCAs = x509.NewCertPool()
+		for _, file := range r.clientCAFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return false, err
+			}
+			if !clientCAs.AppendCertsFromPEM(pem) {
+				return false, fmt.Errorf("no certificate found in %s", file)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// watch 定时检查证书文件，直到 ctx 结束
+func (r *keyPairReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.WithError(err).Errorf("reload certificate %s fail, keep serving the previous one", r.certFile)
+				continue
+			}
+			if reloaded {
+				log.Infof("certificate %s reloaded", r.certFile)
+			}
+		}
+	}
+}
+
+func (r *keyPairReloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *keyPairReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+func (r *keyPairReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// isSelf 判断对端证书是否是当前加载的证书，用于内部 gateway 回环连接
+func (r *keyPairReloader) isSelf(rawCerts [][]byte) bool {
+	cert := r.certificate()
+	return len(rawCerts) > 0 && cert != nil && bytes.Equal(rawCerts[0], cert.Certificate[0])
+}
+
+// verifyClientCertificate 校验客户端证书，内部回环连接使用服务端自身证书
+func (r *keyPairReloader) verifyClientCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) < 1 {
+		return fmt.Errorf("client certificate required")
+	}
+	if r.isSelf(rawCerts) {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// verifyLoopbackCertificate 内部回环连接只信任服务端当前加载的证书
+func (r *keyPairReloader) verifyLoopbackCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if !r.isSelf(rawCerts) {
+		return fmt.Errorf("loopback peer certificate mismatch")
+	}
+	return nil
+}
+
+func (r *keyPairReloader) serverConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.getCertificate,
+	}
+	if len(r.clientCAFiles) > 0 {
+		// 证书链由 verifyClientCertificate 校验，以支持 CA 热更新
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = r.verifyClientCertificate
+	}
+	return cfg
+}
+
+// loopbackCredentials 内部 gateway, healthz 连接本服务使用的证书
+func (r *keyPairReloader) loopbackCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 证书由 verifyLoopbackCertificate 校验
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: r.verifyLoopbackCertificate,
+		GetClientCertificate:  r.getClientCertificate,
+	})
+}
@@ -0,0 +1,229 @@
+package webserver_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert parent 为 nil 时生成自签名的 CA
+func newTestCert(t *testing.T, serial int64, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "webserver test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// write 写入 pem 文件，返回证书和私钥的路径
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func startTLSServer(t *testing.T, srv *webserver.Webserver) string {
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ServeTLS()
+	}()
+	t.Cleanup(func() {
+		srv.Stop()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	})
+	return srv.Addr().String()
+}
+
+// peerSerial 返回服务端当前使用的证书序列号
+func peerSerial(t *testing.T, addr string, cfg *tls.Config) int64 {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, 0)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, 2, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	client := newTestCert(t, 3, ca, x509.ExtKeyUsageClientAuth)
+
+	srv := webserver.NewServer(
+		webserver.WithAddr("127.0.0.1", 0),
+		webserver.WithTLS(certFile, keyFile),
+		webserver.WithClientCA(caFile),
+		webserver.WithTLSReloadInterval(20*time.Millisecond),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startTLSServer(t, srv)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	mtls := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.tlsCertificate()}}
+	anonymous := &tls.Config{RootCAs: roots}
+
+	echo := func(cfg *tls.Config) error {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		reply, err := pb.NewEchoServiceClient(conn).Echo(ctx, &pb.Message{Value: "tls"})
+		if err == nil && reply.Value != "[tls]" {
+			err = errors.New("unexpected reply " + reply.Value)
+		}
+		return err
+	}
+	// gateway 通过固定证书的回环连接调用 grpc
+	gateway := func(cfg *tls.Config) error {
+		transport := &http.Transport{TLSClientConfig: cfg}
+		defer transport.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: transport}).Post(
+			"https://"+addr+"/echo", "application/json", strings.NewReader(`{"value":"tls"}`))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "[tls]") {
+			return errors.New("unexpected response " + resp.Status + " " + string(body))
+		}
+		return nil
+	}
+
+	if err := echo(mtls); err != nil {
+		t.Fatalf("grpc over tls: %v", err)
+	}
+	if err := gateway(mtls); err != nil {
+		t.Fatalf("gateway over tls: %v", err)
+	}
+	// 双向认证拒绝没有证书的客户端
+	if err := echo(anonymous); err == nil {
+		t.Error("expect grpc client without certificate rejected")
+	}
+	if err := gateway(anonymous); err == nil {
+		t.Error("expect http client without certificate rejected")
+	}
+
+	if err := srv.ServeTLS(); !errors.Is(err, webserver.ErrServerStarted) {
+		t.Errorf("expect ErrServerStarted, got %v", err)
+	}
+
+	// 替换证书后自动重新加载
+	if serial := peerSerial(t, addr, mtls); serial != 2 {
+		t.Fatalf("unexpected serial %d", serial)
+	}
+	newTestCert(t, 4, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for peerSerial(t, addr, mtls) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := gateway(mtls); err != nil {
+		t.Errorf("gateway after reload: %v", err)
+	}
+}
+
+func TestServeTLSWithoutReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, 0)
+	certFile, keyFile := newTestCert(t, 2, ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	srv := webserver.NewServer(
+		webserver.WithAddr("127.0.0.1", 0),
+		webserver.WithTLS(certFile, keyFile),
+		webserver.WithTLSReloadInterval(0),
+	)
+	addr := startTLSServer(t, srv)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if serial := peerSerial(t, addr, &tls.Config{RootCAs: roots}); serial != 2 {
+		t.Errorf("unexpected serial %d", serial)
+	}
+}
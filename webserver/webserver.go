@@ -2,21 +2,33 @@ package webserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/limingyao/excellent-go/metrics/prometheus"
+	"github.com/limingyao/excellent-go/webserver/interceptors"
 	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 const (
@@ -28,83 +40,374 @@ const (
 )
 
 type Webserver struct {
-	ctx    context.Context
-	cancel context.CancelFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	lis     net.Listener
+	started bool
 
 	ip         string
 	port       int
 	httpMux    *http.ServeMux
 	gatewayMux *runtime.ServeMux
 	grpcSrv    *grpc.Server
+	httpSrv    *http.Server
 
 	gatewayOptions       []runtime.ServeMuxOption // gateway option
 	dialOptions          []grpc.DialOption        // gateway dial grpc option
 	serverOptions        []grpc.ServerOption      // grpc option
-	handlersFromEndpoint []HandlerFromEndpoint    // gateway handlers
+	handlersFromEndpoint []gatewayHandler         // gateway handlers
+
+	admin *admin      // WithAdminAddr
+	unix  *unixSocket // WithUnixSocket
+
+	openapiFS       fs.FS
+	openapiPath     string
+	swaggerUIPath   string
+	swaggerUIAssets string
+	routesPath      string
+	httpRoutes      []string                         // RegisterHttpHandler 注册的路由
+	gatewayServices []protoreflect.ServiceDescriptor // 已注册 gateway handler 的服务
+
+	descriptors              *descriptorSet // WithDescriptorSet
+	descriptorReloadInterval time.Duration
 
 	enableHealthz     bool
 	healthzPath       string
+	livezPath         string
+	readyzPath        string
+	readinessInterval time.Duration
+	readinessTimeout  time.Duration
+	healthz           *healthz
 	enableReflection  bool
 	enablePProf       bool
 	pprofPath         string
 	enablePrometheus  bool
 	prometheusOptions []prometheus.Option
 	prometheusPath    string
+
+	enableTracing      bool
+	enableMarshalers   bool
+	httpMiddlewares    []interceptors.HttpMiddleware
+	enableSSE          bool
+	sseHeartbeat       time.Duration
+	enableWebSocket    bool
+	wsHeartbeat        time.Duration
+	enableGrpcWeb      bool
+	grpcWebCORSOptions []interceptors.CORSOption
+	enableHttpMetrics  bool
+	httpMetricsOptions []interceptors.MetricsOption
+
+	certFile          string
+	keyFile           string
+	clientCAFiles     []string
+	tlsReloadInterval time.Duration
+	keyPair           *keyPairReloader
+
+	signals         []os.Signal
+	drainPeriod     time.Duration
+	shutdownTimeout time.Duration
+	inflight        atomic.Int64
+	streams         context.Context // drain 结束后取消，结束 SSE, WebSocket, grpc stream 等长连接请求
+	cancelStreams   context.CancelFunc
+	done            chan struct{}
+	doneOnce        sync.Once
 }
 
 func NewServer(opts ...ServerOption) *Webserver {
 	ctx, cancel := context.WithCancel(context.Background())
+	streams, cancelStreams := context.WithCancel(context.Background())
 	s := &Webserver{
 		ctx:            ctx,
 		cancel:         cancel,
+		streams:        streams,
+		cancelStreams:  cancelStreams,
 		healthzPath:    "/healthz",
+		livezPath:      "/livez",
+		readyzPath:     "/readyz",
 		pprofPath:      "/debug/pprof",
 		prometheusPath: "/metrics",
+
+		readinessInterval: 10 * time.Second,
+		readinessTimeout:  3 * time.Second,
+		healthz:           newHealthz(),
+
+		tlsReloadInterval: 30 * time.Second,
+
+		descriptorReloadInterval: 30 * time.Second,
+
+		shutdownTimeout: 30 * time.Second,
+		done:            make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	// Shutdown 时结束 grpc stream
+	s.serverOptions = append([]grpc.ServerOption{
+		grpc.ChainStreamInterceptor(s.streamServerInterceptor()),
+	}, s.serverOptions...)
+	if s.enableTracing {
+		// tracing 放在最前面，span 覆盖其他 interceptor
+		s.serverOptions = append([]grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfTracing()),
+			grpc.ChainStreamInterceptor(interceptors.StreamServerInterceptorOfTracing()),
+		}, s.serverOptions...)
+	}
+	// 转发 X-Session-Id，WithGatewayOptions 可覆盖
+	s.gatewayOptions = append([]runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(IncomingHeaderMatcher),
+	}, s.gatewayOptions...)
+	if s.enableMarshalers {
+		// 默认 marshaler 放在最前面，WithGatewayOptions 可覆盖
+		s.gatewayOptions = append(defaultMarshalerOptions(), s.gatewayOptions...)
+	}
+	if s.admin != nil {
+		s.admin.httpMux = http.NewServeMux()
+		s.admin.grpcSrv = grpc.NewServer()
+	}
 	s.httpMux = http.NewServeMux()
 	s.gatewayMux = runtime.NewServeMux(s.gatewayOptions...)
 	s.grpcSrv = grpc.NewServer(s.serverOptions...)
 	return s
 }
 
-func (s *Webserver) Serve() error {
-	// httpMux 执行最长前缀匹配，注册路径最后必须以/结尾才会触发，否则都交由/路径处理
-	// 所有未匹配到的路径最终都会交给/路径处理
-	s.httpMux.Handle("/", s.gatewayMux)
+// Listen 监听 WithAddr 配置的地址，在 Serve 之前调用可通过 Addr 获取系统分配的端口
+func (s *Webserver) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
-			s.grpcSrv.ServeHTTP(w, r)
-		} else {
-			s.httpMux.ServeHTTP(w, r)
+	if s.lis != nil {
+		return ErrServerListening
+	}
+
+	addr := net.JoinHostPort(s.ip, strconv.Itoa(s.port))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return &ListenError{Network: "tcp", Addr: addr, Err: err}
+	}
+	if err := s.listenExtra(); err != nil {
+		_ = lis.Close()
+		return err
+	}
+	s.lis = lis
+
+	return nil
+}
+
+// Addr 返回监听地址，未监听时返回 nil
+func (s *Webserver) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+func (s *Webserver) listener() (net.Listener, error) {
+	if s.Addr() == nil {
+		if err := s.Listen(); err != nil && !errors.Is(err, ErrServerListening) {
+			return nil, err
 		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lis, nil
+}
+
+func (s *Webserver) Serve() error {
+	lis, err := s.listener()
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(lis)
+}
+
+// ServeListener 在 lis 上提供服务，可以传入 bufconn, systemd socket activation 等自定义 listener
+func (s *Webserver) ServeListener(lis net.Listener) error {
+	if err := s.start(lis); err != nil {
+		return err
+	}
+	defer s.cancel()
+
+	if err := s.register(); err != nil {
+		return err
+	}
+	handler := s.handler()
+	if err := s.serveExtra(handler); err != nil {
+		return err
+	}
+
+	h2s := &http2.Server{}
+	srv := &http.Server{Handler: h2c.NewHandler(handler, h2s)}
+	// 注册 http2 优雅退出，Shutdown 时向 h2c 连接发送 GOAWAY
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	return s.serve(srv, func() error {
+		return srv.Serve(lis)
 	})
+}
 
-	// 监听端口
-	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.ip, s.port))
+// ServeTLS 使用 WithTLS 配置的证书提供 https 服务，http/2 通过 ALPN 协商，证书文件更新后自动重新加载，
+// admin 端口和 unix socket 仍然提供明文服务
+func (s *Webserver) ServeTLS() error {
+	lis, err := s.listener()
 	if err != nil {
-		log.WithError(err).Fatal("listen failed")
+		return err
+	}
+	return s.ServeTLSListener(lis)
+}
+
+// ServeTLSListener 在 lis 上提供 https 服务
+func (s *Webserver) ServeTLSListener(lis net.Listener) error {
+	if len(s.certFile) < 1 || len(s.keyFile) < 1 {
+		return ErrTLSNotConfigured
+	}
+
+	keyPair, err := newKeyPairReloader(s.certFile, s.keyFile, s.clientCAFiles)
+	if err != nil {
+		return err
+	}
+	// 先检查是否已启动，避免覆盖运行中服务的证书
+	if err := s.start(lis); err != nil {
+		return err
 	}
 	defer s.cancel()
 
-	// 获取分配的端口
-	if s.port == 0 {
-		items := strings.Split(lis.Addr().String(), ":")
-		if len(items) > 1 {
-			s.port, err = strconv.Atoi(items[len(items)-1])
-			if err != nil {
-				log.WithError(err).Errorf("convert %s to int fail", items[len(items)-1])
-			}
-		}
+	s.mu.Lock()
+	s.keyPair = keyPair
+	s.mu.Unlock()
+	if s.tlsReloadInterval > 0 {
+		go keyPair.watch(s.ctx, s.tlsReloadInterval)
+	}
+
+	if err := s.register(); err != nil {
+		return err
+	}
+	handler := s.handler()
+	if err := s.serveExtra(handler); err != nil {
+		return err
 	}
+
+	srv := &http.Server{Handler: handler, TLSConfig: keyPair.serverConfig()}
+	if err := http2.ConfigureServer(srv, &http2.Server{}); err != nil {
+		return err
+	}
+	return s.serve(srv, func() error {
+		return srv.ServeTLS(lis, "", "")
+	})
+}
+
+// start 记录 listener，每个 Webserver 只能启动一次
+func (s *Webserver) start(lis net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrServerStarted
+	}
+	s.started = true
+	s.lis = lis
 	log.Infof("webserver started on %s", lis.Addr().String())
 
+	return nil
+}
+
+// serve 调用 Shutdown 或 Stop 后等待退出完成并返回 nil
+func (s *Webserver) serve(srv *http.Server, fn func() error) error {
+	s.mu.Lock()
+	s.httpSrv = srv
+	s.mu.Unlock()
+
+	if len(s.signals) > 0 {
+		go s.handleSignals()
+	}
+
+	if err := fn(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-s.done
+	return nil
+}
+
+func (s *Webserver) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, s.signals...)
+	defer signal.Stop(ch)
+
+	select {
+	case sig := <-ch:
+		log.Infof("received signal %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("shutdown fail")
+		}
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *Webserver) handler() http.Handler {
+	// httpMux 执行最长前缀匹配，注册路径最后必须以/结尾才会触发，否则都交由/路径处理
+	// 所有未匹配到的路径最终都会交给/路径处理
+	var gateway http.Handler = s.gatewayMux
+	if s.descriptors != nil {
+		gateway = s.descriptors
+	}
+	if s.enableMarshalers {
+		gateway = prettyHandler(gateway)
+	}
+	if s.enableSSE {
+		gateway = sseHandler(gateway, s.sseHeartbeat)
+	}
+	if s.enableWebSocket {
+		gateway = websocketHandler(gateway, s.wsHeartbeat)
+	}
+	if s.enableTracing {
+		gateway = interceptors.HttpHandlerOfTracing("/", gateway)
+	}
+	s.httpMux.Handle("/", gateway)
+
+	// 中间件只作用于 gateway 和 http 路由，不作用于原生 grpc 请求
+	var httpHandler http.Handler = s.httpMux
+	if len(s.httpMiddlewares) > 0 {
+		httpHandler = interceptors.ChainHttpMiddleware(s.httpMiddlewares...)(httpHandler)
+	}
+
+	// grpc-web 与原生 grpc 相同，不经过 http 中间件
+	var grpcWeb http.Handler
+	if s.enableGrpcWeb {
+		grpcWeb = s.grpcWebHandler()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inflight.Inc()
+		defer s.inflight.Dec()
+
+		if isStreamRequest(r) {
+			ctx, cancel := s.streamContext(r.Context())
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		switch {
+		case grpcWeb != nil && (isGrpcWebRequest(r) || s.isGrpcWebPreflight(r)):
+			grpcWeb.ServeHTTP(w, r)
+		case r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc"):
+			s.grpcSrv.ServeHTTP(w, r)
+		default:
+			httpHandler.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (s *Webserver) register() error {
 	if s.enableHealthz {
 		if err := s.registerHealthServer(); err != nil {
-			log.WithError(err).Error()
+			return err
 		}
 	}
 	if s.enableReflection {
@@ -116,73 +419,157 @@ func (s *Webserver) Serve() error {
 	if s.enablePrometheus {
 		s.registerPrometheus()
 	}
-	s.registerGatewayHandler()
+	if s.openapiFS != nil {
+		if err := s.registerOpenAPI(); err != nil {
+			return err
+		}
+	}
+	if len(s.routesPath) > 0 {
+		s.httpMux.HandleFunc(s.routesPath, s.routesHandler)
+	}
+	if s.descriptors != nil {
+		if err := s.registerDescriptorSet(); err != nil {
+			return err
+		}
+	}
+	return s.registerGatewayHandler()
+}
 
-	return http.Serve(lis, h2c.NewHandler(handler, &http2.Server{}))
+// endpoint gateway, healthz 连接本服务的地址
+func (s *Webserver) endpoint() string {
+	addr := s.Addr()
+	switch addr.Network() {
+	case "unix":
+		return fmt.Sprintf("unix:%s", addr.String())
+	case "tcp", "tcp4", "tcp6":
+		host, port, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			break
+		}
+		// 监听所有地址时连接本机
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = ""
+		}
+		return fmt.Sprintf("passthrough:///%s", net.JoinHostPort(host, port))
+	}
+	return fmt.Sprintf("passthrough:///%s", addr.String())
 }
 
-func (s *Webserver) ServeTLS() error {
-	// TODO ...
-	return nil
+// contextDialer bufconn.Listener
+type contextDialer interface {
+	DialContext(ctx context.Context) (net.Conn, error)
 }
 
-func (s *Webserver) registerHealthServer() error {
-	registerHealthServer(s.grpcSrv)
+func (s *Webserver) listenerDialer() (contextDialer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.lis.(contextDialer)
+	return d, ok
+}
 
-	cc, err := grpc.Dial(fmt.Sprintf("passthrough:///%s:%d", s.ip, s.port), s.dialOptions...)
-	if err != nil {
-		log.WithError(err).Errorf("dail fail")
-		return err
+// loopbackDialOptions gateway, healthz 连接本服务的 dial option，开启 tls 时使用服务端证书
+func (s *Webserver) loopbackDialOptions() []grpc.DialOption {
+	opts := make([]grpc.DialOption, 0, len(s.dialOptions)+3)
+	if s.enableTracing {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(interceptors.UnaryClientInterceptorOfTracing()),
+			grpc.WithChainStreamInterceptor(interceptors.StreamClientInterceptorOfTracing()),
+		)
 	}
-
-	runtime.WithHealthEndpointAt(newHealthClient(cc), s.healthzPath)(s.gatewayMux)
-
-	SetServerStatus(ServingStatus)
-
-	return nil
+	// bufconn 等内存 listener 通过 DialContext 连接
+	if d, ok := s.listenerDialer(); ok {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return d.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+	}
+	opts = append(opts, s.dialOptions...)
+	s.mu.Lock()
+	keyPair := s.keyPair
+	s.mu.Unlock()
+	if keyPair != nil {
+		opts = append(opts, grpc.WithTransportCredentials(keyPair.loopbackCredentials()))
+	}
+	return opts
 }
 
 func (s *Webserver) registerReflectionServer() {
+	if s.admin != nil {
+		s.registerAdminReflectionServer()
+		return
+	}
 	s.RegisterGrpcServer(func(srv *grpc.Server) {
 		reflection.Register(srv)
 	})
 }
 
 func (s *Webserver) registerPProf() {
-	s.httpMux.HandleFunc(fmt.Sprintf("%s/", s.pprofPath), pprof.Index)
-	s.httpMux.HandleFunc(fmt.Sprintf("%s/cmdline", s.pprofPath), pprof.Cmdline)
-	s.httpMux.HandleFunc(fmt.Sprintf("%s/profile", s.pprofPath), pprof.Profile)
-	s.httpMux.HandleFunc(fmt.Sprintf("%s/symbol", s.pprofPath), pprof.Symbol)
-	s.httpMux.HandleFunc(fmt.Sprintf("%s/trace", s.pprofPath), pprof.Trace)
+	s.internalMux().HandleFunc(fmt.Sprintf("%s/", s.pprofPath), pprof.Index)
+	s.internalMux().HandleFunc(fmt.Sprintf("%s/cmdline", s.pprofPath), pprof.Cmdline)
+	s.internalMux().HandleFunc(fmt.Sprintf("%s/profile", s.pprofPath), pprof.Profile)
+	s.internalMux().HandleFunc(fmt.Sprintf("%s/symbol", s.pprofPath), pprof.Symbol)
+	s.internalMux().HandleFunc(fmt.Sprintf("%s/trace", s.pprofPath), pprof.Trace)
 }
 
 func (s *Webserver) registerPrometheus() {
-	s.httpMux.Handle(s.prometheusPath, prometheus.Handler(s.prometheusOptions...))
+	s.internalMux().Handle(s.prometheusPath, prometheus.Handler(s.prometheusOptions...))
 }
 
 func (s *Webserver) RegisterHttpHandler(pattern string, handler http.Handler) {
+	if s.enableHttpMetrics {
+		handler = interceptors.HttpHandlerOfMetrics(pattern, handler, s.httpMetricsOptions...)
+	}
+	if s.enableTracing {
+		handler = interceptors.HttpHandlerOfTracing(pattern, handler)
+	}
+	s.mu.Lock()
+	s.httpRoutes = append(s.httpRoutes, pattern)
+	s.mu.Unlock()
 	s.httpMux.Handle(pattern, handler)
 }
 
 type HandlerFromEndpoint func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
 
+type gatewayHandler struct {
+	handler  HandlerFromEndpoint
+	services []string
+}
+
+// RegisterGatewayHandlerFromEndpoint 注册 gateway handler，services 为 handler 对应的 grpc 服务全名，
+// 如 pb.EchoService_ServiceDesc.ServiceName，用于 Routes 列出其 google.api.http 路由
 func (s *Webserver) RegisterGatewayHandlerFromEndpoint(
-	endpoint string, opts []grpc.DialOption, handlerFromEndpoint HandlerFromEndpoint,
-) {
+	endpoint string, opts []grpc.DialOption, handlerFromEndpoint HandlerFromEndpoint, services ...string,
+) error {
 	if err := handlerFromEndpoint(s.ctx, s.gatewayMux, endpoint, opts); err != nil {
-		log.Fatal(err)
+		return &RegisterError{Endpoint: endpoint, Err: err}
+	}
+	for _, service := range services {
+		sd, err := findService(service)
+		if err != nil {
+			return &RegisterError{Endpoint: endpoint, Err: err}
+		}
+		s.mu.Lock()
+		s.gatewayServices = append(s.gatewayServices, sd)
+		s.mu.Unlock()
 	}
+	return nil
 }
 
-func (s *Webserver) RegisterGatewayHandlerWithDefault(handlerFromEndpoint HandlerFromEndpoint) {
-	s.handlersFromEndpoint = append(s.handlersFromEndpoint, handlerFromEndpoint)
+// RegisterGatewayHandlerWithDefault Serve 时使用本服务的地址注册 gateway handler，services 同 RegisterGatewayHandlerFromEndpoint
+func (s *Webserver) RegisterGatewayHandlerWithDefault(handlerFromEndpoint HandlerFromEndpoint, services ...string) {
+	s.handlersFromEndpoint = append(s.handlersFromEndpoint, gatewayHandler{handler: handlerFromEndpoint, services: services})
 }
 
-func (s *Webserver) registerGatewayHandler() {
-	endpoint := fmt.Sprintf("passthrough:///%s:%d", s.ip, s.port)
-	for i := range s.handlersFromEndpoint {
-		s.RegisterGatewayHandlerFromEndpoint(endpoint, s.dialOptions, s.handlersFromEndpoint[i])
+func (s *Webserver) registerGatewayHandler() error {
+	endpoint := s.endpoint()
+	for _, h := range s.handlersFromEndpoint {
+		if err := s.RegisterGatewayHandlerFromEndpoint(endpoint, s.loopbackDialOptions(), h.handler, h.services...); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (s *Webserver) RegisterGrpcServer(fn func(srv *grpc.Server)) {
@@ -201,7 +588,121 @@ func (s *Webserver) GrpcServer() *grpc.Server {
 	return s.grpcSrv
 }
 
+// Shutdown 优雅退出：健康检查置为 NOT_SERVING，等待 drain 时间后停止接收新请求，取消 SSE, WebSocket, grpc stream
+// 等长连接请求，并等待处理中的请求结束，ctx 结束时强制退出
+func (s *Webserver) Shutdown(ctx context.Context) error {
+	defer s.stop()
+
+	// 所有服务置为 NOT_SERVING，之后的状态更新都会被忽略
+	s.healthz.server.Shutdown()
+
+	if s.drainPeriod > 0 {
+		log.Infof("webserver draining for %v", s.drainPeriod)
+		select {
+		case <-time.After(s.drainPeriod):
+		case <-ctx.Done():
+		}
+	}
+	// 长连接请求不会主动结束，drain 结束后取消，只等待普通请求
+	s.cancelStreams()
+
+	var err error
+	if srv := s.httpServer(); srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+	if e := s.shutdownUnix(ctx); err == nil {
+		err = e
+	}
+	if err == nil {
+		// h2c 连接被 hijack，http.Server.Shutdown 不会等待其上的请求
+		err = s.waitInflight(ctx)
+	}
+	if err != nil {
+		s.Stop()
+		return err
+	}
+
+	// ServeHTTP 处理中的 grpc 请求不支持 GracefulStop，需要在请求全部结束后调用
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		s.shutdownAdmin(ctx)
+		log.Info("webserver shutdown")
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Webserver) waitInflight(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.inflight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// isStreamRequest SSE, WebSocket 长连接请求
+func isStreamRequest(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), mimeEventStream) || websocket.IsWebSocketUpgrade(r)
+}
+
+// streamContext 返回 Shutdown 的 drain 结束后取消的 context
+func (s *Webserver) streamContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-s.streams.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// streamServerInterceptor grpc stream 的 context 在 Shutdown 的 drain 结束后取消
+func (s *Webserver) streamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := s.streamContext(ss.Context())
+		defer cancel()
+
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// Stop 立即退出，中断处理中的请求
 func (s *Webserver) Stop() {
-	s.cancel()
+	defer s.stop()
+
+	if srv := s.httpServer(); srv != nil {
+		_ = srv.Close()
+	}
+	s.closeExtra()
 	s.grpcSrv.Stop()
 }
+
+func (s *Webserver) httpServer() *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.httpSrv
+}
+
+func (s *Webserver) stop() {
+	s.cancel()
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
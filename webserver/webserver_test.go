@@ -1,24 +1,54 @@
 package webserver_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/limingyao/excellent-go/encoding"
+	apperrors "github.com/limingyao/excellent-go/errors"
 	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/tracing"
 	"github.com/limingyao/excellent-go/webserver"
 	"github.com/limingyao/excellent-go/webserver/interceptors"
+	"github.com/limingyao/excellent-go/webserver/webservertest"
 	log "github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 type echoService struct {
@@ -49,12 +79,12 @@ func (*protoMarshaller) Marshal(value interface{}) ([]byte, error) {
 }
 
 func TestNewServer(t *testing.T) {
-	srv := webserver.NewServer(
-		webserver.WithPort(8080),
+	srv := webservertest.NewServer(t,
 		webserver.WithHealthz(),
 		webserver.WithPProf(),
 		webserver.WithReflection(),
 		webserver.WithPrometheus(),
+		webserver.WithDefaultMarshalers(),
 		webserver.WithServerOptions([]grpc.ServerOption{
 			grpc.MaxRecvMsgSize(webserver.ServerMaxReceiveMessageSize),
 			grpc.MaxSendMsgSize(webserver.ServerMaxSendMessageSize),
@@ -64,6 +94,12 @@ func TestNewServer(t *testing.T) {
 				interceptors.UnaryServerInterceptorOfSessionId(),
 				interceptors.UnaryServerInterceptorOfDebug(),
 			),
+			grpc.ChainStreamInterceptor(
+				interceptors.StreamServerInterceptorOfRecovery(),
+				interceptors.StreamServerInterceptorOfContext(),
+				interceptors.StreamServerInterceptorOfSessionId(),
+				interceptors.StreamServerInterceptorOfDebug(),
+			),
 		}...),
 		webserver.WithDialOptions([]grpc.DialOption{
 			grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -76,6 +112,11 @@ func TestNewServer(t *testing.T) {
 				interceptors.UnaryClientInterceptorOfSessionId(),
 				interceptors.UnaryClientInterceptorOfDebug(),
 			),
+			grpc.WithChainStreamInterceptor(
+				interceptors.StreamClientInterceptorOfMetadata(),
+				interceptors.StreamClientInterceptorOfSessionId(),
+				interceptors.StreamClientInterceptorOfDebug(),
+			),
 		}...),
 		webserver.WithGatewayOptions([]runtime.ServeMuxOption{
 			// request: protobuf, response: json
@@ -151,15 +192,1278 @@ func TestNewServer(t *testing.T) {
 		}...),
 	)
 
-	// TODO support ?
-	// https://grpc-ecosystem.github.io/grpc-gateway/docs/mapping/customizing_your_gateway/#pretty-print-json-responses-when-queried-with-pretty
-
 	srv.RegisterGrpcServer(func(srv *grpc.Server) {
 		pb.RegisterEchoServiceServer(srv, &echoService{})
 	})
 	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	srv.Start()
+
+	// echoService 随机返回 InvalidArgument
+	_, err := pb.NewEchoServiceClient(srv.Conn).Echo(context.Background(), &pb.Message{Value: "a"})
+	if code := status.Code(err); code != codes.OK && code != codes.InvalidArgument {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	resp, err := srv.Client.Post(webservertest.URL+"/echo?pretty", encoding.MIMEJSON, strings.NewReader(`{"value":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if resp.Header.Get("X-Test") != "true" || !strings.Contains(string(body), "{[a]}") {
+			t.Errorf("unexpected response %v %s", resp.Header, body)
+		}
+	case http.StatusBadRequest:
+	default:
+		t.Errorf("unexpected response %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestListen(t *testing.T) {
+	srv := webserver.NewServer(
+		webserver.WithAddr("127.0.0.1", 0),
+		webserver.WithHealthz(),
+		webserver.WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.Addr().(*net.TCPAddr)
+	if addr.Port == 0 {
+		t.Fatal("port not assigned")
+	}
+
+	// port conflict
+	conflict := webserver.NewServer(webserver.WithAddr("127.0.0.1", addr.Port))
+	var listenErr *webserver.ListenError
+	if err := conflict.Serve(); !errors.As(err, &listenErr) {
+		t.Fatalf("expect ListenError, got %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve()
+	}()
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get(fmt.Sprintf("http://%s/healthz", addr)); err == nil && resp.StatusCode == http.StatusOK {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz status %d", resp.StatusCode)
+	}
+
+	if err := srv.Serve(); !errors.Is(err, webserver.ErrServerStarted) {
+		t.Fatalf("expect ErrServerStarted, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newServer(opts ...webserver.ServerOption) *webserver.Webserver {
+	opts = append([]webserver.ServerOption{
+		webserver.WithAddr("127.0.0.1", 0),
+		webserver.WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}, opts...)
+	return webserver.NewServer(opts...)
+}
+
+func startServer(t *testing.T, srv *webserver.Webserver) string {
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := srv.Serve(); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(srv.Stop)
+	return srv.Addr().String()
+}
+
+func TestHealthz(t *testing.T) {
+	var ready atomic.Bool
+	srv := newServer(
+		webserver.WithReadinessChecker("dependency", webserver.CheckerFunc(func(ctx context.Context) error {
+			if !ready.Load() {
+				return errors.New("dependency unavailable")
+			}
+			return nil
+		})),
+		webserver.WithReadinessInterval(20*time.Millisecond, time.Second),
+	)
+	addr := startServer(t, srv)
+	other := newServer(webserver.WithHealthz())
+	startServer(t, other)
+	other.SetServerStatus(webserver.NotServingStatus)
+
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := healthpb.NewHealthClient(cc)
+
+	waitStatus := func(service string, expect healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		var status healthpb.HealthCheckResponse_ServingStatus
+		for i := 0; i < 100; i++ {
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if status = resp.GetStatus(); err == nil && status == expect {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("service %q status %s, expect %s", service, status, expect)
+	}
+	httpStatus := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", addr, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
 
-	if err := srv.Serve(); err != nil {
+	waitStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if code := httpStatus("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d", code)
+	}
+	if code := httpStatus("/livez"); code != http.StatusOK {
+		t.Errorf("livez %d", code)
+	}
+
+	ready.Store(true)
+	waitStatus("", healthpb.HealthCheckResponse_SERVING)
+	if code := httpStatus("/readyz"); code != http.StatusOK {
+		t.Errorf("readyz %d", code)
+	}
+
+	srv.SetServiceStatus("echo", webserver.NotServingStatus)
+	waitStatus("echo", healthpb.HealthCheckResponse_NOT_SERVING)
+	if code := httpStatus("/readyz?service=echo"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz echo %d", code)
+	}
+}
+
+func TestHealthzDefaults(t *testing.T) {
+	checked := make(chan struct{}, 1)
+	// 小于等于 0 时使用默认的检查周期和超时时间
+	srv := newServer(
+		webserver.WithReadinessChecker("dependency", webserver.CheckerFunc(func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no timeout")
+			}
+			select {
+			case checked <- struct{}{}:
+			default:
+			}
+			return nil
+		})),
+		webserver.WithReadinessInterval(0, 0),
+	)
+	addr := startServer(t, srv)
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readiness not checked")
+	}
+
+	readyz := func() int {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s/readyz", addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("readyz %d", code)
+	}
+	// 包级别的 SetServerStatus 作用于最后一个开启健康检查的 Webserver
+	webserver.SetServerStatus(webserver.NotServingStatus)
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d after SetServerStatus", code)
+	}
+
+	if err := webserver.DialChecker().Check(context.Background()); err == nil {
+		t.Error("expect error without address")
+	}
+	if err := webserver.DialChecker(addr).Check(context.Background()); err != nil {
 		t.Error(err)
 	}
 }
+
+func TestSignalHandling(t *testing.T) {
+	// 测试进程自己先订阅信号，避免信号未被 Webserver 订阅时进程退出
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	defer signal.Stop(ch)
+
+	srv := newServer(webserver.WithSignalHandling(syscall.SIGUSR1))
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve()
+	}()
+	t.Cleanup(srv.Stop)
+
+	// Serve 启动后才订阅信号，重复发送直到退出
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("expect nil, got %v", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("server not shutdown by signal")
+		case <-ticker.C:
+		}
+	}
+}
+
+func TestShutdownWithStream(t *testing.T) {
+	srv := newServer(webserver.WithServerSentEvents(10*time.Millisecond), webserver.WithDrainPeriod(100*time.Millisecond))
+	canceled := make(chan struct{})
+	handleStream(t, srv, canceled)
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve()
+	}()
+	t.Cleanup(srv.Stop)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+srv.Addr().String()+"/stream?block=1", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 16)
+	if _, err := resp.Body.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// drain 结束后取消 SSE 请求，不等待到 ctx 超时
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if cost := time.Since(start); cost > 3*time.Second {
+		t.Errorf("shutdown cost %v", cost)
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Error("stream not canceled")
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
+
+type blockingService struct {
+	pb.UnimplementedEchoServiceServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	close(s.started)
+	<-s.release
+	return &pb.Message{Value: "[" + req.Value + "]"}, nil
+}
+
+func TestDrainPeriod(t *testing.T) {
+	svc := &blockingService{started: make(chan struct{}), release: make(chan struct{})}
+	srv := newServer(webserver.WithHealthz(), webserver.WithDrainPeriod(time.Second))
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, svc)
+	})
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve()
+	}()
+	t.Cleanup(srv.Stop)
+	addr := srv.Addr().String()
+
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	called := make(chan error, 1)
+	go func() {
+		reply, err := pb.NewEchoServiceClient(cc).Echo(context.Background(), &pb.Message{Value: "drain"})
+		if err == nil && reply.Value != "[drain]" {
+			err = errors.New("unexpected reply " + reply.Value)
+		}
+		called <- err
+	}()
+	<-svc.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	// drain 期间继续接收请求，健康检查返回 NOT_SERVING
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(fmt.Sprintf("http://%s/readyz", addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readyz %d during drain", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err := healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("unexpected status %s during drain", resp.Status)
+	}
+
+	// 处理中的请求正常完成
+	close(svc.release)
+	if err := <-called; err != nil {
+		t.Errorf("in-flight call: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	srv := newServer(webserver.WithTracing())
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &echoService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/echo", addr), strings.NewReader(`{"value":"a"}`))
+		req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		req.Header.Set("X-Session-Id", "session-1")
+		if resp, err = http.DefaultClient.Do(req); err == nil && resp.StatusCode != http.StatusNotFound {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	spans := recorder.Ended()
+	kinds := map[trace.SpanKind]int{}
+	for _, span := range spans {
+		if span.SpanContext().TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("span %s not in the trace", span.Name())
+		}
+		kinds[span.SpanKind()]++
+		if span.Name() == "internal.proto.EchoService/Echo" && span.SpanKind() == trace.SpanKindServer {
+			found := false
+			for _, attr := range span.Attributes() {
+				if attr.Key == tracing.SessionKey && attr.Value.AsString() == "session-1" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("session_id not found in %v", span.Attributes())
+			}
+		}
+	}
+	if kinds[trace.SpanKindServer] != 2 || kinds[trace.SpanKindClient] != 1 {
+		t.Errorf("unexpected spans %v", kinds)
+	}
+}
+
+type errorService struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (errorService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	err := apperrors.New(codes.NotFound, "USER_NOT_FOUND", "user not found").
+		WithMetadata(map[string]string{"user": req.Value}).
+		WithRetry(1500 * time.Millisecond)
+	return nil, fmt.Errorf("query user: %w", err)
+}
+
+func TestErrorHandler(t *testing.T) {
+	srv := newServer(
+		webserver.WithServerOptions(grpc.ChainUnaryInterceptor(
+			interceptors.UnaryServerInterceptorOfContext(),
+			interceptors.UnaryServerInterceptorOfError(),
+		)),
+		webserver.WithGatewayOptions(runtime.WithErrorHandler(webserver.ErrorHandler)),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &errorService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo", strings.NewReader(`{"value":"tom"}`))
+	req.Header.Set("X-Session-Id", "session")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("unexpected response %d, retry after %s", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	var body webserver.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != int32(codes.NotFound) || body.Status != "NOT_FOUND" || body.Reason != "USER_NOT_FOUND" ||
+		body.Message != "user not found" || body.Metadata["user"] != "tom" || !body.Retryable || body.SessionId != "session" {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
+
+func TestGatewayRateLimit(t *testing.T) {
+	// OfContext 在限流之前，gateway 请求使用 X-Forwarded-For 中的客户端 ip
+	srv := newServer(
+		webserver.WithServerOptions(grpc.ChainUnaryInterceptor(
+			interceptors.UnaryServerInterceptorOfContext(),
+			interceptors.UnaryServerInterceptorOfRateLimit(interceptors.WithClientLimit(0.1, 1)),
+		)),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	call := func(ip string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo", strings.NewReader(`{"value":"a"}`))
+		req.Header.Set("X-Forwarded-For", ip)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := call("10.0.0.1"); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if code := call("10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expect %d, got %d", http.StatusTooManyRequests, code)
+	}
+	// 不同客户端不共用回环地址的限流器
+	if code := call("10.0.0.2"); code != http.StatusOK {
+		t.Errorf("unexpected status %d", code)
+	}
+}
+
+type valueService struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (valueService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	return &pb.Message{Value: "[" + req.Value + "]"}, nil
+}
+
+func TestMarshalers(t *testing.T) {
+	srv := newServer(webserver.WithDefaultMarshalers())
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        []byte
+		want        []byte
+		wantType    string
+	}{
+		{"json", "", encoding.MIMEJSON, []byte(`{"value":"tom"}`), []byte(`{"value":"[tom]"}`), encoding.MIMEJSON},
+		{"pretty", "?pretty", encoding.MIMEJSON, []byte(`{"value":"tom"}`), []byte(`{"value":"[tom]"}`), encoding.MIMEJSON},
+		{"yaml", "", encoding.MIMEYAML, []byte("value: tom\n"), []byte("value: '[tom]'\n"), encoding.MIMEYAML},
+		{"msgpack", "", encoding.MIMEMSGPACK, mustMarshal(t, msgpack.Marshal, map[string]string{"value": "tom"}),
+			mustMarshal(t, msgpack.Marshal, map[string]string{"value": "[tom]"}), encoding.MIMEMSGPACK},
+		{"protobuf", "", encoding.MIMEPROTOBUF, mustMarshal(t, marshalProto, &pb.Message{Value: "tom"}),
+			mustMarshal(t, marshalProto, &pb.Message{Value: "[tom]"}), encoding.MIMEPROTOBUF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo"+tt.query, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Accept", tt.contentType)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tt.wantType {
+				t.Fatalf("unexpected response %d %s: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			}
+			if tt.query == "?pretty" {
+				// protojson 会随机插入空格，去掉后再比较
+				if !bytes.HasPrefix(body, []byte("{\n  \"value\":")) {
+					t.Errorf("not pretty %q", body)
+				}
+				var compact bytes.Buffer
+				_ = json.Compact(&compact, body)
+				body = compact.Bytes()
+			}
+			if !bytes.Equal(body, tt.want) {
+				t.Errorf("got %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func marshalProto(v interface{}) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func mustMarshal(t *testing.T, marshal func(interface{}) ([]byte, error), v interface{}) []byte {
+	b, err := marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestHttpMiddleware(t *testing.T) {
+	srv := newServer(webserver.WithHttpMiddleware(
+		interceptors.HttpMiddlewareOfCORS(),
+		interceptors.HttpMiddlewareOfSecurityHeaders(),
+	))
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo", strings.NewReader(`{"value":"tom"}`))
+	req.Header.Set("Origin", "https://example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Content-Type-Options") != "nosniff" ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// 原生 grpc 请求不经过 http 中间件
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	var header metadata.MD
+	if _, err := pb.NewEchoServiceClient(cc).Echo(context.Background(), &pb.Message{Value: "tom"},
+		grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Get("X-Content-Type-Options")) > 0 {
+		t.Errorf("unexpected grpc header %v", header)
+	}
+}
+
+type sessionService struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (sessionService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	return &pb.Message{Value: interceptors.SessionIDFromContext(ctx)}, nil
+}
+
+func TestHTTPSessionId(t *testing.T) {
+	srv := newServer(
+		webserver.WithServerOptions(grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptorOfContext())),
+		webserver.WithHttpMiddleware(
+			interceptors.HttpMiddlewareOfAccessLog(),
+			interceptors.HttpMiddlewareOfSessionId(),
+		),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &sessionService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	srv.RegisterHttpHandler("/session/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, interceptors.SessionIDFromContext(r.Context()))
+	}))
+	addr := startServer(t, srv)
+
+	for _, path := range []string{"/echo", "/session/"} {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr+path, strings.NewReader(`{"value":"tom"}`))
+		req.Header.Set("X-Request-Id", "request-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.Header.Get("X-Session-Id") != "request-1" || resp.Header.Get("X-Request-Id") != "request-1" ||
+			!strings.Contains(string(body), "request-1") {
+			t.Errorf("%s: unexpected response %v %s", path, resp.Header, body)
+		}
+	}
+}
+
+type metadataService struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+// Echo 返回 metadata 中 req.Value 对应的值
+func (metadataService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &pb.Message{Value: strings.Join(md.Get(req.Value), ",")}, nil
+}
+
+func TestIncomingHeaderMatcher(t *testing.T) {
+	srv := newServer()
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &metadataService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+
+	// 同时携带 X-Session-Id, X-Request-Id 时都转发给 grpc 服务
+	for key, want := range map[string]string{"X-Session-Id": "session-1", "X-Request-Id": "request-1"} {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo", strings.NewReader(`{"value":"`+key+`"}`))
+		req.Header.Set("X-Session-Id", "session-1")
+		req.Header.Set("X-Request-Id", "request-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"`+want+`"`) {
+			t.Errorf("%s: unexpected response %d %s", key, resp.StatusCode, body)
+		}
+	}
+}
+
+// handleStream 模拟 gateway 生成的 server-streaming 和 bidi-streaming handler
+func handleStream(t *testing.T, srv *webserver.Webserver, canceled chan<- struct{}) {
+	mux := srv.GatewayMux()
+	err := mux.HandlePath(http.MethodGet, "/stream", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{})
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		i := 0
+		runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) {
+			if i++; i <= 2 {
+				return &pb.Message{Value: fmt.Sprint(i)}, nil
+			}
+			if r.URL.Query().Get("block") == "" {
+				return nil, status.Error(codes.Aborted, "aborted")
+			}
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mux.HandlePath(http.MethodPost, "/bidi", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{})
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		dec := inbound.NewDecoder(r.Body)
+		runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) {
+			var msg pb.Message
+			if err := dec.Decode(&msg); err != nil {
+				return nil, err
+			}
+			return &pb.Message{Value: "[" + msg.Value + "]"}, nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	srv := newServer(webserver.WithServerSentEvents(10 * time.Millisecond))
+	canceled := make(chan struct{})
+	handleStream(t, srv, canceled)
+	addr := startServer(t, srv)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/stream", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+	want := "data: {\"result\":{\"value\":\"1\"}}\n\n" +
+		"data: {\"result\":{\"value\":\"2\"}}\n\n" +
+		"event: error\ndata: "
+	if !strings.HasPrefix(strings.ReplaceAll(string(body), ": ping\n\n", ""), want) {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// 客户端断开时取消 stream
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/stream?block=1", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_, _ = resp.Body.Read(buf)
+	cancel()
+	resp.Body.Close()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("stream not canceled")
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	srv := newServer(webserver.WithWebSocket(10 * time.Millisecond))
+	handleStream(t, srv, nil)
+	addr := startServer(t, srv)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/bidi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, value := range []string{"a", "b"} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"value":"`+value+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"result":{"value":"[` + value + `]"}}`; string(msg) != want {
+			t.Errorf("got %s, want %s", msg, want)
+		}
+	}
+
+	// 正常关闭时结束请求流，服务端关闭连接
+	conn.SetCloseHandler(func(int, string) error { return nil })
+	err = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestAdminAddr(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "webserver.sock")
+	srv := newServer(
+		webserver.WithHealthz(),
+		webserver.WithPProf(),
+		webserver.WithPrometheus(),
+		webserver.WithReflection(),
+		webserver.WithAdminAddr("127.0.0.1", 0),
+		webserver.WithUnixSocket(socket),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+	addr := startServer(t, srv)
+	adminAddr := srv.AdminAddr().String()
+
+	get := func(client *http.Client, url string) int {
+		for i := 0; i < 50; i++ {
+			resp, err := client.Get(url)
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("get %s fail", url)
+		return 0
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics", "/debug/pprof/"} {
+		if code := get(http.DefaultClient, "http://"+addr+path); code != http.StatusNotFound {
+			t.Errorf("public %s: got %d", path, code)
+		}
+		if code := get(http.DefaultClient, "http://"+adminAddr+path); code != http.StatusOK {
+			t.Errorf("admin %s: got %d", path, code)
+		}
+	}
+
+	// 健康检查和 reflection 只在 admin 端口
+	for target, want := range map[string]codes.Code{addr: codes.Unimplemented, adminAddr: codes.OK} {
+		cc, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cc.Close()
+		_, err = healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if status.Code(err) != want {
+			t.Errorf("%s health check: %v", target, err)
+		}
+
+		stream, err := reflectionpb.NewServerReflectionClient(cc).ServerReflectionInfo(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := stream.Recv()
+		if status.Code(err) != want {
+			t.Errorf("%s reflection: %v", target, err)
+		}
+		if err == nil && !strings.Contains(resp.String(), "EchoService") {
+			t.Errorf("%s reflection: %v", target, resp)
+		}
+	}
+
+	// unix socket 提供与公开端口相同的服务
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := unixClient.Post("http://unix/echo", encoding.MIMEJSON, strings.NewReader(`{"value":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "[a]") {
+		t.Errorf("unix socket: unexpected response %d %s", resp.StatusCode, body)
+	}
+	if code := get(unixClient, "http://unix/metrics"); code != http.StatusNotFound {
+		t.Errorf("unix socket /metrics: got %d", code)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	specFS := fstest.MapFS{
+		"echo/echo_service.swagger.json": {Data: []byte(`{
+  "swagger": "2.0",
+  "info": {"title": "echo_service.proto", "version": "1.0"},
+  "tags": [{"name": "EchoService"}],
+  "consumes": ["application/json"],
+  "paths": {"/echo": {"post": {"operationId": "EchoService_Echo"}}},
+  "definitions": {"protoMessage": {"type": "object"}, "rpcStatus": {"type": "object"}}
+}`)},
+		"user/user_service.swagger.json": {Data: []byte(`{
+  "swagger": "2.0",
+  "info": {"title": "user_service.proto", "version": "1.0"},
+  "tags": [{"name": "UserService"}, {"name": "EchoService"}],
+  "consumes": ["application/json"],
+  "paths": {"/v1/users/{id}": {"get": {"operationId": "UserService_GetUser"}}},
+  "definitions": {"protoUser": {"type": "object"}, "rpcStatus": {"type": "object"}}
+}`)},
+		"README.md": {Data: []byte("not a swagger file")},
+	}
+	srv := newServer(
+		webserver.WithOpenAPI(specFS, "/swagger.json"),
+		webserver.WithSwaggerUI("/swagger-ui/", ""),
+		webserver.WithRoutesPath("/routes"),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint, pb.EchoService_ServiceDesc.ServiceName)
+	srv.RegisterHttpHandler("/session/", http.NotFoundHandler())
+	addr := startServer(t, srv)
+
+	get := func(path string, v interface{}) string {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected response %d %s", path, resp.StatusCode, body)
+		}
+		if v != nil {
+			if err := json.Unmarshal(body, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return string(body)
+	}
+
+	var spec struct {
+		Info        map[string]string          `json:"info"`
+		Tags        []map[string]string        `json:"tags"`
+		Consumes    []string                   `json:"consumes"`
+		Paths       map[string]json.RawMessage `json:"paths"`
+		Definitions map[string]json.RawMessage `json:"definitions"`
+	}
+	get("/swagger.json", &spec)
+	if spec.Info["title"] != "echo_service.proto" || len(spec.Tags) != 2 || len(spec.Consumes) != 1 ||
+		len(spec.Paths) != 2 || spec.Paths["/v1/users/{id}"] == nil || len(spec.Definitions) != 3 {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+
+	if page := get("/swagger-ui/", nil); !strings.Contains(page, `src="/swagger-ui/swagger-ui-bundle.js"`) ||
+		!strings.Contains(page, `"/swagger.json"`) {
+		t.Errorf("unexpected swagger ui %s", page)
+	}
+	// 内嵌的静态资源
+	if js := get("/swagger-ui/swagger-ui-bundle.js", nil); !strings.Contains(js, "SwaggerUIBundle") {
+		t.Error("unexpected swagger-ui-bundle.js")
+	}
+	if css := get("/swagger-ui/swagger-ui.css", nil); !strings.Contains(css, ".swagger-ui") {
+		t.Error("unexpected swagger-ui.css")
+	}
+
+	var routes []webserver.Route
+	get("/routes", &routes)
+	want := []webserver.Route{
+		{Method: http.MethodPost, Path: "/echo", GrpcMethod: "/internal.proto.EchoService/Echo", Body: "*"},
+		{Path: "/session/"},
+	}
+	if fmt.Sprint(routes) != fmt.Sprint(want) {
+		t.Errorf("got routes %+v, want %+v", routes, want)
+	}
+
+	// 只注册 grpc 服务，没有注册 gateway handler 时不返回 gateway 路由
+	grpcOnly := newServer()
+	grpcOnly.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	startServer(t, grpcOnly)
+	if routes := grpcOnly.Routes(); len(routes) != 0 {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+
+	// 服务不存在时注册失败
+	var registerErr *webserver.RegisterError
+	err := grpcOnly.RegisterGatewayHandlerFromEndpoint(grpcOnly.Addr().String(),
+		[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		pb.RegisterEchoServiceHandlerFromEndpoint, "internal.proto.UnknownService")
+	if !errors.As(err, &registerErr) || !strings.Contains(err.Error(), "UnknownService") {
+		t.Errorf("expect RegisterError, got %v", err)
+	}
+}
+
+// writeDescriptorSet 写入 bundle.pb.desc，bindings 作为 Echo 方法的 additional_bindings
+func writeDescriptorSet(t *testing.T, path string, bindings ...*annotations.HttpRule) {
+	b, err := os.ReadFile("../internal/proto/bundle.pb.desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range set.GetFile() {
+		if fd.GetName() != "echo_service.proto" {
+			continue
+		}
+		opts := fd.GetService()[0].GetMethod()[0].GetOptions()
+		rule := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+		rule.AdditionalBindings = bindings
+		proto.SetExtension(opts, annotations.E_Http, rule)
+	}
+	if b, err = proto.Marshal(set); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDescriptorSet(t *testing.T) {
+	if err := newServer().ReloadDescriptorSet(); !errors.Is(err, webserver.ErrDescriptorSetNotConfigured) {
+		t.Errorf("unexpected reload error %v", err)
+	}
+
+	dir := t.TempDir()
+	writeDescriptorSet(t, filepath.Join(dir, "echo.desc"))
+	srv := newServer(
+		webserver.WithDescriptorSet(dir),
+		webserver.WithDescriptorSetReloadInterval(0),
+		webserver.WithHealthz(),
+		webserver.WithRoutesPath("/routes"),
+	)
+	// 只注册 grpc 服务，不注册 gateway handler
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	addr := startServer(t, srv)
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, "http://"+addr+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, body := do(http.MethodPost, "/echo", `{"value":"a"}`); code != http.StatusOK || body != `{"value":"[a]"}` {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	if code, body := do(http.MethodPost, "/echo", `{"value":`); code != http.StatusBadRequest {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	// 未匹配的请求交给 gatewayMux
+	if code, body := do(http.MethodGet, "/healthz", ""); code != http.StatusOK {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	if code, body := do(http.MethodGet, "/v1/echo/b", ""); code != http.StatusNotFound {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+
+	writeDescriptorSet(t, filepath.Join(dir, "echo.desc"),
+		&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/echo/{value}"}},
+		&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/echo"}},
+	)
+	if err := srv.ReloadDescriptorSet(); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := do(http.MethodGet, "/v1/echo/b", ""); code != http.StatusOK || body != `{"value":"[b]"}` {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	if code, body := do(http.MethodGet, "/v1/echo?value=c", ""); code != http.StatusOK || body != `{"value":"[c]"}` {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+
+	// 加载失败时继续使用之前的路由
+	if err := os.WriteFile(filepath.Join(dir, "broken.desc"), []byte("broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ReloadDescriptorSet(); err == nil {
+		t.Error("expect reload error")
+	}
+	if code, body := do(http.MethodGet, "/v1/echo/d", ""); code != http.StatusOK || body != `{"value":"[d]"}` {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+
+	var routes []webserver.Route
+	_, body := do(http.MethodGet, "/routes", "")
+	if err := json.Unmarshal([]byte(body), &routes); err != nil {
+		t.Fatal(err)
+	}
+	want := []webserver.Route{
+		{Method: http.MethodPost, Path: "/echo", GrpcMethod: "/internal.proto.EchoService/Echo", Body: "*"},
+		{Method: http.MethodGet, Path: "/v1/echo", GrpcMethod: "/internal.proto.EchoService/Echo"},
+		{Method: http.MethodGet, Path: "/v1/echo/{value}", GrpcMethod: "/internal.proto.EchoService/Echo"},
+	}
+	if fmt.Sprint(routes) != fmt.Sprint(want) {
+		t.Errorf("got routes %+v, want %+v", routes, want)
+	}
+}
+
+// grpcWebFrames 解析 grpc-web 响应，返回 data frame 和 trailer frame
+func grpcWebFrames(t *testing.T, body []byte, text bool) (messages [][]byte, trailer string) {
+	if text {
+		var decoded []byte
+		// 多段带 padding 的 base64
+		for i := 0; i+4 <= len(body); i += 4 {
+			b, err := base64.StdEncoding.DecodeString(string(body[i : i+4]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded = append(decoded, b...)
+		}
+		body = decoded
+	}
+	for len(body) >= 5 {
+		n := int(binary.BigEndian.Uint32(body[1:5]))
+		if len(body) < 5+n {
+			t.Fatalf("truncated frame %q", body)
+		}
+		if body[0]&0x80 != 0 {
+			trailer = string(body[5 : 5+n])
+		} else {
+			messages = append(messages, body[5:5+n])
+		}
+		body = body[5+n:]
+	}
+	return messages, trailer
+}
+
+func TestGrpcWeb(t *testing.T) {
+	srv := webservertest.NewServer(t,
+		webserver.WithGrpcWeb(interceptors.WithAllowedOrigins("https://*.example.com")),
+	)
+	srv.RegisterGrpcServer(func(srv *grpc.Server) {
+		pb.RegisterEchoServiceServer(srv, &valueService{})
+	})
+	srv.Start()
+
+	msg, err := proto.Marshal(&pb.Message{Value: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+
+	call := func(path, contentType string, body []byte) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, webservertest.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		req.Header.Set("Origin", "https://app.example.com")
+		resp, err := srv.Client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+			t.Fatalf("unexpected response %d %v %q", resp.StatusCode, resp.Header, b)
+		}
+		return resp, b
+	}
+
+	for _, tc := range []struct {
+		contentType string
+		text        bool
+	}{
+		{"application/grpc-web", false},
+		{"application/grpc-web+proto", false},
+		{"application/grpc-web-text", true},
+	} {
+		body := frame
+		if tc.text {
+			// 请求由两段带 padding 的 base64 组成
+			body = []byte(base64.StdEncoding.EncodeToString(frame[:4]) + base64.StdEncoding.EncodeToString(frame[4:]))
+		}
+		resp, b := call("/internal.proto.EchoService/Echo", tc.contentType, body)
+		if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+			!strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "Grpc-Status") {
+			t.Errorf("%s: unexpected cors headers %v", tc.contentType, resp.Header)
+		}
+		messages, trailer := grpcWebFrames(t, b, tc.text)
+		if len(messages) != 1 || !strings.Contains(trailer, "grpc-status: 0\r\n") {
+			t.Fatalf("%s: unexpected frames %q %q", tc.contentType, messages, trailer)
+		}
+		reply := &pb.Message{}
+		if err := proto.Unmarshal(messages[0], reply); err != nil || reply.Value != "[web]" {
+			t.Errorf("%s: unexpected reply %v %v", tc.contentType, reply, err)
+		}
+	}
+
+	// 错误只有 trailer frame
+	_, b := call("/internal.proto.EchoService/Missing", "application/grpc-web", frame)
+	if messages, trailer := grpcWebFrames(t, b, false); len(messages) != 0 ||
+		!strings.Contains(trailer, fmt.Sprintf("grpc-status: %d\r\n", codes.Unimplemented)) {
+		t.Errorf("unexpected frames %q %q", messages, trailer)
+	}
+
+	preflight := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, webservertest.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+		resp, err := srv.Client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	if resp := preflight("/internal.proto.EchoService/Echo"); resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Headers") != "content-type,x-grpc-web,x-user-agent" {
+		t.Errorf("unexpected preflight response %d %v", resp.StatusCode, resp.Header)
+	}
+	// 非 grpc 方法的预检请求交给 http 路由
+	if resp := preflight("/echo"); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected preflight response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// 原生 grpc 不受影响
+	reply, err := pb.NewEchoServiceClient(srv.Conn).Echo(context.Background(), &pb.Message{Value: "grpc"})
+	if err != nil || reply.Value != "[grpc]" {
+		t.Errorf("unexpected reply %v %v", reply, err)
+	}
+}
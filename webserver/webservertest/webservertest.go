@@ -0,0 +1,124 @@
+// Package webservertest 在内存 bufconn 上启动 Webserver，用于 grpc 和 gateway 的单元测试
+package webservertest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/limingyao/excellent-go/webserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	bufSize = 1024 * 1024
+
+	// URL http 请求的地址前缀，如 Client.Get(URL + "/healthz")
+	URL = "http://bufconn"
+)
+
+// ReadyTimeout 等待服务就绪的最长时间
+var ReadyTimeout = 5 * time.Second
+
+// Server 使用 bufconn 的 Webserver，Start 后 Conn 和 Client 可用
+type Server struct {
+	*webserver.Webserver
+
+	Conn   *grpc.ClientConn // 连接 grpc 服务
+	Client *http.Client     // 连接 gateway 和 http 路由，请求地址使用 URL
+
+	t   testing.TB
+	lis *bufconn.Listener
+}
+
+// NewServer 创建 Webserver，注册服务后调用 Start
+func NewServer(t testing.TB, opts ...webserver.ServerOption) *Server {
+	t.Helper()
+	return &Server{
+		Webserver: webserver.NewServer(opts...),
+		t:         t,
+		lis:       bufconn.Listen(bufSize),
+	}
+}
+
+// Start 启动服务并等待就绪，开启 WithHealthz 时等待健康检查返回 SERVING，测试结束时自动停止
+func (s *Server) Start() *Server {
+	t := s.t
+	t.Helper()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ServeListener(s.lis)
+	}()
+
+	conn, err := grpc.Dial("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Conn = conn
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		},
+	}
+	s.Client = &http.Client{Transport: transport}
+
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		_ = conn.Close()
+		s.Stop()
+		_ = s.lis.Close()
+		if err := <-errCh; err != nil {
+			t.Errorf("webserver serve fail: %v", err)
+		}
+	})
+
+	if err := s.waitReady(errCh); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// waitReady 健康检查返回 SERVING 或未开启健康检查时认为就绪
+func (s *Server) waitReady(errCh chan error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ReadyTimeout)
+	defer cancel()
+
+	client := healthpb.NewHealthClient(s.Conn)
+	for {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		switch {
+		case err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING:
+			return nil
+		case status.Code(err) == codes.Unimplemented:
+			return nil
+		}
+
+		select {
+		case err := <-errCh:
+			// 让 Cleanup 能读到退出结果
+			errCh <- err
+			if err == nil {
+				err = errors.New("webserver stopped before ready")
+			}
+			return err
+		case <-ctx.Done():
+			return errors.New("webserver not ready: " + ctx.Err().Error())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
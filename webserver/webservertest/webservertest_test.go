@@ -0,0 +1,58 @@
+package webservertest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	pb "github.com/limingyao/excellent-go/internal/proto"
+	"github.com/limingyao/excellent-go/webserver"
+	"github.com/limingyao/excellent-go/webserver/webservertest"
+	"google.golang.org/grpc"
+)
+
+type echoService struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (echoService) Echo(ctx context.Context, req *pb.Message) (*pb.Message, error) {
+	return &pb.Message{Value: "[" + req.Value + "]"}, nil
+}
+
+func TestServer(t *testing.T) {
+	for _, name := range []string{"default", "healthz"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var opts []webserver.ServerOption
+			if name == "healthz" {
+				opts = append(opts, webserver.WithHealthz())
+			}
+			srv := webservertest.NewServer(t, opts...)
+			srv.RegisterGrpcServer(func(srv *grpc.Server) {
+				pb.RegisterEchoServiceServer(srv, &echoService{})
+			})
+			srv.RegisterGatewayHandlerWithDefault(pb.RegisterEchoServiceHandlerFromEndpoint)
+			srv.Start()
+
+			resp, err := pb.NewEchoServiceClient(srv.Conn).Echo(context.Background(), &pb.Message{Value: "grpc"})
+			if err != nil || resp.Value != "[grpc]" {
+				t.Fatalf("unexpected response %v, %v", resp, err)
+			}
+
+			httpResp, err := srv.Client.Post(webservertest.URL+"/echo", "application/json",
+				strings.NewReader(`{"value":"http"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer httpResp.Body.Close()
+			body, _ := io.ReadAll(httpResp.Body)
+			if httpResp.StatusCode != http.StatusOK || !strings.Contains(string(body), "[http]") {
+				t.Errorf("unexpected response %d %s", httpResp.StatusCode, body)
+			}
+		})
+	}
+}